@@ -0,0 +1,336 @@
+package nova
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HeaderWWWAuthenticate is the header challenges are sent in
+const HeaderWWWAuthenticate = "WWW-Authenticate"
+
+// ErrNoCredentials is returned by an Authenticator when the request has no credentials for its scheme
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials is returned by an Authenticator when the credentials are wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// UnauthorizedError is returned when a route needs authentication, the default error func
+// responds with 401 Unauthorized and the reason
+type UnauthorizedError struct {
+	Reason string
+}
+
+// Error implements error
+func (e *UnauthorizedError) Error() string {
+	return "unauthorized: " + e.Reason
+}
+
+// AuthenticatorError is returned when an authenticator fails for a reason other than the credentials
+// such as its user store being unavailable, the default error func responds with 500 Internal Server Error
+type AuthenticatorError struct {
+	Err error
+}
+
+// Error implements error
+func (e *AuthenticatorError) Error() string {
+	return "couldn't authenticate request: " + e.Err.Error()
+}
+
+// Unwrap returns the authenticator's error
+func (e *AuthenticatorError) Unwrap() error {
+	return e.Err
+}
+
+// Principal is the authenticated identity making a request
+type Principal struct {
+	// ID identifies the user, client or key
+	ID string
+
+	// Scheme is the authentication scheme used such as basic, bearer or apikey
+	Scheme string
+
+	Roles  []string
+	Scopes []string
+
+	// Attributes holds anything else known about the principal
+	Attributes map[string]interface{}
+}
+
+// principalKey is the context key for the authenticated principal
+var principalKey = NewKey[*Principal]("principal")
+
+// Principal returns the authenticated principal or nil if the request wasn't authenticated
+func (r *Request) Principal() *Principal {
+	p, _ := Get(r, principalKey)
+	return p
+}
+
+// withScheme returns a copy of p with the scheme set so principals shared between requests aren't modified
+func withScheme(p *Principal, scheme string) *Principal {
+	cp := *p
+	cp.Scheme = scheme
+	return &cp
+}
+
+// Authenticator checks the credentials for a single scheme
+type Authenticator interface {
+	// Authenticate returns the principal for the request's credentials. It returns ErrNoCredentials
+	// if the request has none for the scheme and ErrInvalidCredentials or an UnauthorizedError if
+	// they're wrong, any other error is passed to the error func as an AuthenticatorError.
+	Authenticate(r *Request) (*Principal, error)
+
+	// Challenge returns the WWW-Authenticate value sent when authentication is required, "" sends none
+	Challenge() string
+}
+
+// RequireAuth returns a guard that authenticates requests with the first authenticator that finds
+// credentials, responding with 401 and the authenticators' challenges if none do.
+// Add it to a group or route with Guard.
+func RequireAuth(authenticators ...Authenticator) RequestFunc {
+	return authGuard(authenticators, true)
+}
+
+// OptionalAuth returns a guard that authenticates requests that have credentials and lets
+// requests without them through. Invalid credentials are still rejected.
+func OptionalAuth(authenticators ...Authenticator) RequestFunc {
+	return authGuard(authenticators, false)
+}
+
+func authGuard(authenticators []Authenticator, required bool) RequestFunc {
+	return func(r *Request) error {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+
+			var unauthorized *UnauthorizedError
+			if errors.As(err, &unauthorized) {
+				challenge(r, a)
+				return unauthorized
+			}
+
+			if errors.Is(err, ErrInvalidCredentials) || (err == nil && p == nil) {
+				challenge(r, a)
+				return &UnauthorizedError{Reason: "invalid credentials"}
+			}
+
+			if err != nil {
+				return &AuthenticatorError{Err: err}
+			}
+
+			Set(r, principalKey, p)
+			return nil
+		}
+
+		if !required {
+			return nil
+		}
+
+		challenge(r, authenticators...)
+		return &UnauthorizedError{Reason: "authentication required"}
+	}
+}
+
+// challenge adds the WWW-Authenticate challenges for the authenticators
+func challenge(r *Request, authenticators ...Authenticator) {
+	for _, a := range authenticators {
+		if c := a.Challenge(); c != "" {
+			r.Header().Add(HeaderWWWAuthenticate, c)
+		}
+	}
+}
+
+// BasicAuthFunc returns the principal for a username and password or ErrInvalidCredentials
+type BasicAuthFunc func(ctx context.Context, username, password string) (*Principal, error)
+
+// basicAuth authenticates HTTP Basic credentials
+type basicAuth struct {
+	realm string
+	check BasicAuthFunc
+}
+
+// BasicAuth returns an authenticator for HTTP Basic credentials
+func BasicAuth(realm string, check BasicAuthFunc) Authenticator {
+	return &basicAuth{realm: realm, check: check}
+}
+
+// Authenticate implements Authenticator
+func (a *basicAuth) Authenticate(r *Request) (*Principal, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.check(r.Context(), user, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return withScheme(p, "basic"), nil
+}
+
+// Challenge implements Authenticator
+func (a *basicAuth) Challenge() string {
+	return `Basic realm=` + strconv.Quote(a.realm) + `, charset="UTF-8"`
+}
+
+// BasicAuthUsers checks credentials against a fixed set of usernames and passwords in constant time
+func BasicAuthUsers(users map[string]string) BasicAuthFunc {
+	return func(_ context.Context, username, password string) (*Principal, error) {
+		// compare every user so the time taken doesn't reveal which usernames exist
+		match := 0
+		for u, p := range users {
+			match |= secureCompare(u, username) & secureCompare(p, password)
+		}
+
+		if match != 1 {
+			return nil, ErrInvalidCredentials
+		}
+
+		return &Principal{ID: username}, nil
+	}
+}
+
+// secureCompare compares the hashes of a and b in constant time returning 1 if they're equal
+func secureCompare(a, b string) int {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:])
+}
+
+// TokenFunc returns the principal for a token or ErrInvalidCredentials
+type TokenFunc func(ctx context.Context, token string) (*Principal, error)
+
+// bearerAuth authenticates bearer tokens from the Authorization header
+type bearerAuth struct {
+	realm string
+	check TokenFunc
+}
+
+// BearerAuth returns an authenticator for bearer tokens sent in the Authorization header
+func BearerAuth(realm string, check TokenFunc) Authenticator {
+	return &bearerAuth{realm: realm, check: check}
+}
+
+// Authenticate implements Authenticator
+func (a *bearerAuth) Authenticate(r *Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.check(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return withScheme(p, "bearer"), nil
+}
+
+// Challenge implements Authenticator
+func (a *bearerAuth) Challenge() string {
+	return `Bearer realm=` + strconv.Quote(a.realm)
+}
+
+// bearerToken returns the token from an Authorization header using the Bearer scheme
+func bearerToken(r *Request) (string, bool) {
+	auth := r.Request.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+// APIKeyOptions configures where API keys are read from
+type APIKeyOptions struct {
+	// Header the key is read from such as X-API-Key
+	Header string
+
+	// Query is the query parameter the key is read from when it isn't in the header
+	Query string
+
+	// Check returns the principal for a key or ErrInvalidCredentials
+	Check TokenFunc
+}
+
+// apiKeyAuth authenticates API keys from a header or query parameter
+type apiKeyAuth struct {
+	opts APIKeyOptions
+}
+
+// APIKeyAuth returns an authenticator for API keys sent in a header or query parameter
+func APIKeyAuth(opts APIKeyOptions) Authenticator {
+	return &apiKeyAuth{opts: opts}
+}
+
+// Authenticate implements Authenticator
+func (a *apiKeyAuth) Authenticate(r *Request) (*Principal, error) {
+	key := ""
+	if a.opts.Header != "" {
+		key = r.Request.Header.Get(a.opts.Header)
+	}
+
+	if key == "" && a.opts.Query != "" {
+		key = r.QueryParam(a.opts.Query)
+	}
+
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.opts.Check(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return withScheme(p, "apikey"), nil
+}
+
+// Challenge implements Authenticator, API keys have no standard challenge
+func (a *apiKeyAuth) Challenge() string {
+	return ""
+}
+
+// StaticKeys checks keys against a fixed set in constant time, returning a copy of the key's principal
+func StaticKeys(keys map[string]Principal) TokenFunc {
+	hashed := make(map[[sha256.Size]byte]Principal, len(keys))
+	for k, p := range keys {
+		hashed[sha256.Sum256([]byte(k))] = p
+	}
+
+	return func(_ context.Context, key string) (*Principal, error) {
+		h := sha256.Sum256([]byte(key))
+		var found *Principal
+		for k, p := range hashed {
+			if subtle.ConstantTimeCompare(k[:], h[:]) == 1 {
+				p := p
+				found = &p
+			}
+		}
+
+		if found == nil {
+			return nil, ErrInvalidCredentials
+		}
+
+		return found, nil
+	}
+}
@@ -0,0 +1,129 @@
+package nova
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	basic := BasicAuth("admin", BasicAuthUsers(map[string]string{"alice": "s3cret"}))
+	bearer := BearerAuth("api", func(ctx context.Context, token string) (*Principal, error) {
+		if token != "tok" {
+			return nil, ErrInvalidCredentials
+		}
+
+		return &Principal{ID: "service", Scopes: []string{"read"}}, nil
+	})
+	apiKey := APIKeyAuth(APIKeyOptions{
+		Header: "X-API-Key",
+		Query:  "api_key",
+		Check:  StaticKeys(map[string]Principal{"k1": {ID: "partner"}}),
+	})
+
+	s := New()
+	whoami := func(req *Request) error {
+		if p := req.Principal(); p != nil {
+			return req.Send(p.Scheme + ":" + p.ID)
+		}
+
+		return req.Send("anonymous")
+	}
+	s.Group("/api").Guard(RequireAuth(basic, bearer, apiKey)).Get("/me", whoami)
+	s.Get("/feed", whoami).Guard(OptionalAuth(bearer))
+	s.Get("/broken", whoami).Guard(RequireAuth(BearerAuth("api", func(ctx context.Context, token string) (*Principal, error) {
+		switch token {
+		case "nil":
+			return nil, nil
+		case "expired":
+			return nil, &UnauthorizedError{Reason: "session expired"}
+		}
+
+		return nil, errors.New("user store is down")
+	})))
+
+	do := func(path string, set func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if set != nil {
+			set(req)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		path string
+		set  func(*http.Request)
+		code int
+		body string
+	}{
+		{"/api/me", func(r *http.Request) { r.SetBasicAuth("alice", "s3cret") }, http.StatusOK, "basic:alice"},
+		{"/api/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }, http.StatusOK, "bearer:service"},
+		{"/api/me", func(r *http.Request) { r.Header.Set("X-API-Key", "k1") }, http.StatusOK, "apikey:partner"},
+		{"/api/me?api_key=k1", nil, http.StatusOK, "apikey:partner"},
+		{"/api/me", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }, http.StatusUnauthorized, ""},
+		{"/api/me?api_key=nope", nil, http.StatusUnauthorized, ""},
+		{"/feed", nil, http.StatusOK, "anonymous"},
+		{"/feed", func(r *http.Request) { r.Header.Set("Authorization", "bearer tok") }, http.StatusOK, "bearer:service"},
+		{"/feed", func(r *http.Request) { r.Header.Set("Authorization", "Bearer bad") }, http.StatusUnauthorized, ""},
+		{"/broken", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nil") }, http.StatusUnauthorized, ""},
+		{"/broken", func(r *http.Request) { r.Header.Set("Authorization", "Bearer expired") }, http.StatusUnauthorized, ""},
+		{"/broken", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }, http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		w := do(test.path, test.set)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s expected %d %q got %d %q", test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("/api/me", nil)
+	challenges := w.Header().Values(HeaderWWWAuthenticate)
+	if w.Code != http.StatusUnauthorized || len(challenges) != 2 ||
+		challenges[0] != `Basic realm="admin", charset="UTF-8"` || challenges[1] != `Bearer realm="api"` {
+		t.Errorf("expected basic and bearer challenges got %d %v", w.Code, challenges)
+	}
+
+	w = do("/api/me", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") })
+	if challenges := w.Header().Values(HeaderWWWAuthenticate); len(challenges) != 1 {
+		t.Errorf("expected only the basic challenge for bad basic credentials got %v", challenges)
+	}
+}
+
+func TestAuth_SharedPrincipal(t *testing.T) {
+	shared := &Principal{ID: "service"}
+	s := New()
+	s.Get("/me", func(req *Request) error {
+		return req.Send(req.Principal().Scheme)
+	}, WithGuard(RequireAuth(BearerAuth("api", func(ctx context.Context, token string) (*Principal, error) {
+		return shared, nil
+	}))))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set("Authorization", "Bearer tok")
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, req)
+				if w.Body.String() != "bearer" {
+					t.Errorf("expected the bearer scheme got %q", w.Body.String())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if shared.Scheme != "" {
+		t.Errorf("expected the returned principal not to be modified got scheme %q", shared.Scheme)
+	}
+}
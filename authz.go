@@ -0,0 +1,178 @@
+package nova
+
+import "sort"
+
+// PolicyFunc decides whether the principal can access the matched route, route params are available
+// from the request
+type PolicyFunc func(p *Principal, r *Request) bool
+
+// requirement is an authorization rule checked after a route's guards
+type requirement struct {
+	// name describes the requirement in route introspection such as role:admin
+	name   string
+	reason string
+	check  func(p *Principal, r *Request) bool
+}
+
+// RequireRoles only allows principals with every role
+func (r *Route) RequireRoles(roles ...string) *Route {
+	return r.require(roleRequirements(roles)...)
+}
+
+// RequireScopes only allows principals with every scope
+func (r *Route) RequireScopes(scopes ...string) *Route {
+	return r.require(scopeRequirements(scopes)...)
+}
+
+// Authorize only allows principals the named policy allows
+func (r *Route) Authorize(name string, policy PolicyFunc) *Route {
+	return r.require(policyRequirement(name, policy))
+}
+
+// require adds the requirements to a copy of the route's options
+func (r *Route) require(reqs ...requirement) *Route {
+	return r.update(func(o *routeOptions) {
+		o.requirements = append(append([]requirement(nil), o.requirements...), reqs...)
+	})
+}
+
+// RequireRoles only allows principals with every role to access routes added to the group after it's called
+func (r *RouteGroup) RequireRoles(roles ...string) *RouteGroup {
+	r.requirements = append(r.requirements, roleRequirements(roles)...)
+	return r
+}
+
+// RequireScopes only allows principals with every scope to access routes added to the group after it's called
+func (r *RouteGroup) RequireScopes(scopes ...string) *RouteGroup {
+	r.requirements = append(r.requirements, scopeRequirements(scopes)...)
+	return r
+}
+
+// Authorize only allows principals the named policy allows to access routes added to the group after it's called
+func (r *RouteGroup) Authorize(name string, policy PolicyFunc) *RouteGroup {
+	r.requirements = append(r.requirements, policyRequirement(name, policy))
+	return r
+}
+
+func roleRequirements(roles []string) []requirement {
+	reqs := make([]requirement, 0, len(roles))
+	for _, role := range roles {
+		role := role
+		reqs = append(reqs, requirement{
+			name:   "role:" + role,
+			reason: "missing role " + role,
+			check: func(p *Principal, _ *Request) bool {
+				return containsString(p.Roles, role)
+			},
+		})
+	}
+
+	return reqs
+}
+
+func scopeRequirements(scopes []string) []requirement {
+	reqs := make([]requirement, 0, len(scopes))
+	for _, scope := range scopes {
+		scope := scope
+		reqs = append(reqs, requirement{
+			name:   "scope:" + scope,
+			reason: "missing scope " + scope,
+			check: func(p *Principal, _ *Request) bool {
+				return containsString(p.Scopes, scope)
+			},
+		})
+	}
+
+	return reqs
+}
+
+func policyRequirement(name string, policy PolicyFunc) requirement {
+	return requirement{
+		name:   "policy:" + name,
+		reason: "denied by policy " + name,
+		check:  policy,
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorize checks a route's requirements against the request's principal
+func authorize(requirements []requirement, req *Request) error {
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	p := req.Principal()
+	if p == nil {
+		return &UnauthorizedError{Reason: "authentication required"}
+	}
+
+	for _, rq := range requirements {
+		if !rq.check(p, req) {
+			return &ForbiddenError{Reason: rq.reason}
+		}
+	}
+
+	return nil
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	// Method is the method the route is registered for or "" for routes added with All
+	Method  string
+	Pattern string
+
+	// Requirements lists the authorization requirements such as role:admin, scope:orders:write
+	// and policy:owner
+	Requirements []string
+}
+
+// Routes returns the registered routes sorted by pattern and method
+func (sn *Server) Routes() []RouteInfo {
+	var routes []RouteInfo
+	for method, node := range sn.loadPaths() {
+		seen := map[*Route]bool{}
+		node.walk(func(rt *Route) {
+			if seen[rt] {
+				return
+			}
+
+			seen[rt] = true
+			info := RouteInfo{Method: method, Pattern: rt.route}
+			for _, rq := range rt.options().requirements {
+				info.Requirements = append(info.Requirements, rq.name)
+			}
+
+			routes = append(routes, info)
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// walk calls fn for every route below the node
+func (n *Node) walk(fn func(*Route)) {
+	if n.route != nil {
+		fn(n.route)
+	}
+
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
@@ -0,0 +1,78 @@
+package nova
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAuthorization(t *testing.T) {
+	users := map[string]*Principal{
+		"admin": {ID: "admin", Roles: []string{"admin"}, Scopes: []string{"orders:read", "orders:write"}},
+		"alice": {ID: "alice", Roles: []string{"user"}, Scopes: []string{"orders:read"}},
+	}
+	auth := BearerAuth("api", func(ctx context.Context, token string) (*Principal, error) {
+		if p, ok := users[token]; ok {
+			return p, nil
+		}
+
+		return nil, ErrInvalidCredentials
+	})
+
+	s := New()
+	api := s.Group("/api").Guard(OptionalAuth(auth)).RequireScopes("orders:read")
+	api.Get("/orders/:user", func(req *Request) error {
+		return req.Send("orders")
+	}).Authorize("owner", func(p *Principal, r *Request) bool {
+		return p.ID == r.RouteParam("user") || containsString(p.Roles, "admin")
+	})
+	api.Delete("/orders/:user", func(req *Request) error {
+		return nil
+	}, WithRoles("admin"), WithScopes("orders:write"))
+
+	do := func(method, path, token string) (int, string) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		var body JSONErrors
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Error.Message
+	}
+
+	tests := []struct {
+		method, path, token string
+		code                int
+		reason              string
+	}{
+		{http.MethodGet, "/api/orders/alice", "alice", http.StatusOK, ""},
+		{http.MethodGet, "/api/orders/bob", "alice", http.StatusForbidden, "denied by policy owner"},
+		{http.MethodGet, "/api/orders/bob", "admin", http.StatusOK, ""},
+		{http.MethodGet, "/api/orders/alice", "", http.StatusUnauthorized, "authentication required"},
+		{http.MethodDelete, "/api/orders/alice", "alice", http.StatusForbidden, "missing role admin"},
+		{http.MethodDelete, "/api/orders/alice", "admin", http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		code, reason := do(test.method, test.path, test.token)
+		if code != test.code || reason != test.reason {
+			t.Errorf("%s %s as %q expected %d %q got %d %q", test.method, test.path, test.token, test.code, test.reason, code, reason)
+		}
+	}
+
+	expected := []RouteInfo{
+		{Method: http.MethodDelete, Pattern: "/api/orders/:user", Requirements: []string{"scope:orders:read", "role:admin", "scope:orders:write"}},
+		{Method: http.MethodGet, Pattern: "/api/orders/:user", Requirements: []string{"scope:orders:read", "policy:owner"}},
+	}
+
+	if routes := s.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("expected routes %+v got %+v", expected, routes)
+	}
+}
@@ -0,0 +1,135 @@
+package nova
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// NoBodyLimit disables an inherited body size limit or read timeout for a route or group
+const NoBodyLimit = -1
+
+// PayloadTooLargeError is returned when reading a request body that exceeds its limit
+type PayloadTooLargeError struct {
+	// Limit is the maximum number of bytes that could be read
+	Limit int64
+}
+
+// Error implements the error interface
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds the limit of %d bytes", e.Limit)
+}
+
+// maxReader is an io.ReadCloser that errors once more than limit bytes are read
+type maxReader struct {
+	r     io.Reader
+	c     io.Closer
+	limit int64
+	n     int64
+	err   error
+}
+
+// newMaxReader limits r to n bytes, c is closed when the reader is closed
+func newMaxReader(r io.Reader, c io.Closer, n int64) *maxReader {
+	return &maxReader{r: r, c: c, limit: n}
+}
+
+// Read reads up to the limit and returns a PayloadTooLargeError when it is exceeded
+func (m *maxReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// the limit can be lowered after more than it has been read
+	if m.n > m.limit {
+		m.err = &PayloadTooLargeError{Limit: m.limit}
+		return 0, m.err
+	}
+
+	// read one byte past the limit so we can tell if the body is too large
+	if remaining := m.limit - m.n + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := m.r.Read(p)
+	m.n += int64(n)
+	if m.n > m.limit {
+		n -= int(m.n - m.limit)
+		m.n = m.limit
+		m.err = &PayloadTooLargeError{Limit: m.limit}
+		return n, m.err
+	}
+
+	if err != nil {
+		m.err = err
+	}
+
+	return n, err
+}
+
+// Close closes the underlying body
+func (m *maxReader) Close() error {
+	if m.c == nil {
+		return nil
+	}
+
+	return m.c.Close()
+}
+
+// limitBody caps the number of bytes that can be read from the request body
+func (r *Request) limitBody(n int64) {
+	if n < 0 {
+		n = math.MaxInt64 - 1
+	}
+
+	// adjust the existing limit if nothing has wrapped the body since
+	if r.bodyReader != nil && r.Request.Body == io.ReadCloser(r.bodyReader) {
+		r.bodyReader.limit = n
+		return
+	}
+
+	if r.Request.Body == nil || r.Request.Body == http.NoBody {
+		return
+	}
+
+	r.bodyReader = newMaxReader(r.Request.Body, r.Request.Body, n)
+	r.Request.Body = r.bodyReader
+}
+
+// setBodyReadDeadline sets a deadline for reading the request body from the connection
+func (r *Request) setBodyReadDeadline(d time.Duration) {
+	if d <= 0 || r.Request.Body == nil || r.Request.Body == http.NoBody {
+		return
+	}
+
+	rc := http.NewResponseController(r.ResponseWriter)
+	if err := rc.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return
+	}
+
+	r.Request.Body = &deadlineBody{ReadCloser: r.Request.Body, rc: rc}
+}
+
+// deadlineBody clears the connection read deadline once the body has been read so it
+// can't interrupt the connection while the handler is still running
+type deadlineBody struct {
+	io.ReadCloser
+	rc *http.ResponseController
+}
+
+// Read reads from the body and clears the deadline at EOF
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF && b.rc != nil {
+		b.rc.SetReadDeadline(time.Time{})
+		b.rc = nil
+	}
+
+	return n, err
+}
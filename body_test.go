@@ -0,0 +1,107 @@
+package nova
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_BodyLimit(t *testing.T) {
+	s := New()
+	s.BodyLimit(16)
+
+	readBody := func(r *Request) error {
+		var body struct {
+			Hello string
+		}
+
+		if err := r.ReadJSON(&body); err != nil {
+			return err
+		}
+
+		return r.Send(body.Hello)
+	}
+
+	s.Post("/small", readBody)
+	s.Post("/large", readBody).BodyLimit(1024)
+	s.Group("/group").BodyLimit(NoBodyLimit).Post("/unlimited", readBody)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tests := map[string]int{
+		"/small":           http.StatusRequestEntityTooLarge,
+		"/large":           http.StatusOK,
+		"/group/unlimited": http.StatusOK,
+	}
+
+	for endpoint, code := range tests {
+		res, err := http.Post(ts.URL+endpoint, "application/json", strings.NewReader(`{"Hello": "a much longer world"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != code {
+			t.Errorf("%s expected %d got %d", endpoint, code, res.StatusCode)
+		}
+	}
+}
+
+func TestServer_BodyLimitLowered(t *testing.T) {
+	s := New()
+	s.BodyLimit(1000)
+	s.Use(func(r *Request, next func()) {
+		// read part of the body before the route's lower limit applies
+		r.Request.Body.Read(make([]byte, 50))
+		next()
+	})
+	s.Post("/small", func(r *Request) error {
+		_, err := io.ReadAll(r.Request.Body)
+		return err
+	}, WithBodyLimit(10))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/small", strings.NewReader(strings.Repeat("a", 100))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 got %d", w.Code)
+	}
+}
+
+func TestServer_BodyReadTimeout(t *testing.T) {
+	s := New()
+	s.BodyReadTimeout(50 * time.Millisecond)
+	s.Post("/test", func(r *Request) error {
+		var body struct{}
+		return r.ReadJSON(&body)
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// send less of the body than promised so the handler blocks reading it
+	fmt.Fprintf(conn, "POST /test HTTP/1.1\r\nHost: test\r\nContent-Length: 20\r\n\r\n{")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expected 408 got %d", res.StatusCode)
+	}
+}
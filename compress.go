@@ -0,0 +1,448 @@
+package nova
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+)
+
+// supported content encodings
+const (
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressMinSize is the response size in bytes below which responses are sent uncompressed
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressContentTypes are the media types compressed when none are configured.
+// Entries ending in a slash match every subtype.
+var DefaultCompressContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// CompressOptions configures the compression middleware
+type CompressOptions struct {
+	// Encodings in order of preference when the client weights them equally.
+	// Defaults to br, gzip then deflate.
+	Encodings []string
+
+	// Level passed to the encoders, 0 uses each encoder's default level
+	Level int
+
+	// MinSize is the minimum response size in bytes to compress, 0 uses DefaultCompressMinSize
+	MinSize int
+
+	// ContentTypes is the allowlist of compressible media types, defaults to DefaultCompressContentTypes
+	ContentTypes []string
+}
+
+// encoder wraps a pooled compressor
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressor holds the pools of encoders and the resolved options
+type compressor struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+	pools        map[string]*sync.Pool
+}
+
+// Compress returns middleware that compresses responses using the encoding negotiated
+// from the Accept-Encoding header. Register it with Server.Use.
+func Compress(opts CompressOptions) func(*Request, func()) {
+	c := &compressor{
+		encodings:    opts.Encodings,
+		minSize:      opts.MinSize,
+		contentTypes: opts.ContentTypes,
+		pools:        map[string]*sync.Pool{},
+	}
+
+	if len(c.encodings) == 0 {
+		c.encodings = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	}
+
+	if c.minSize <= 0 {
+		c.minSize = DefaultCompressMinSize
+	}
+
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = DefaultCompressContentTypes
+	}
+
+	for _, enc := range c.encodings {
+		newFunc := encoderFunc(enc, opts.Level)
+		if newFunc == nil {
+			panic("nova: unsupported compression encoding " + enc)
+		}
+
+		c.pools[enc] = &sync.Pool{New: func() interface{} { return newFunc() }}
+	}
+
+	return func(req *Request, next func()) {
+		// the response depends on Accept-Encoding whether or not we compress it
+		addVary(req.Header(), "Accept-Encoding")
+
+		// ranged and body-less requests are passed through untouched
+		if req.Method != http.MethodHead && req.Request.Header.Get("Range") == "" {
+			enc := negotiateEncoding(req.Request.Header.Get("Accept-Encoding"), c.encodings)
+			if enc != "" {
+				cw := &compressWriter{
+					ResponseWriter: req.ResponseWriter,
+					rw:             req.rw,
+					c:              c,
+					encoding:       enc,
+				}
+
+				req.ResponseWriter = cw
+				req.OnFinish(func() {
+					cw.Close()
+				})
+			}
+		}
+
+		next()
+	}
+}
+
+// encoderFunc returns a constructor for the given encoding or nil if it isn't supported
+func encoderFunc(encoding string, level int) func() encoder {
+	switch encoding {
+	case EncodingGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return func() encoder {
+			w, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+
+			return w
+		}
+	case EncodingDeflate:
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+
+		return func() encoder {
+			w, err := flate.NewWriter(io.Discard, level)
+			if err != nil {
+				w, _ = flate.NewWriter(io.Discard, flate.DefaultCompression)
+			}
+
+			return w
+		}
+	case EncodingBrotli:
+		if level <= 0 || level > brotli.BestCompression {
+			level = brotli.DefaultCompression
+		}
+
+		return func() encoder {
+			return brotli.NewWriterLevel(io.Discard, level)
+		}
+	}
+
+	return nil
+}
+
+// negotiateEncoding picks the supported encoding with the highest quality value from the
+// Accept-Encoding header. Ties are broken by the order of supported.
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseQuality(part)
+		if name == "" {
+			continue
+		}
+
+		weights[strings.ToLower(name)] = q
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, enc := range supported {
+		q, ok := weights[enc]
+		if !ok {
+			q, ok = weights["*"]
+		}
+
+		if ok && q > bestQ {
+			best = enc
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// parseQuality splits a header element such as "gzip;q=0.8" into its value and quality
+func parseQuality(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	name := strings.TrimSpace(params[0])
+	q := 1.0
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil {
+			return name, 0
+		}
+
+		q = v
+	}
+
+	return name, q
+}
+
+// addVary adds the value to the Vary header if it isn't already present
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, existing := range strings.Split(v, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, value) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", value)
+}
+
+// compressWriter buffers the start of a response until it can decide whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	rw       *responseWriter
+	c        *compressor
+	encoding string
+
+	status      int
+	buf         []byte
+	decided     bool
+	wroteHeader bool
+	enc         encoder
+}
+
+// WriteHeader records the status code, the header is sent once the response is inspected
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader || cw.status != 0 {
+		return
+	}
+
+	// informational responses aren't the final header
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.status = code
+	cw.rw.committed = true
+}
+
+// Write buffers data until MinSize is reached then writes it through the encoder
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+		cw.rw.committed = true
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide chooses whether to compress, sends the header and writes out the buffer
+func (cw *compressWriter) decide(force bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.ResponseWriter.Header()
+	if cw.shouldCompress(h, force) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+
+		// a strong validator no longer matches the encoded body
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.enc = cw.c.pools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+
+	return err
+}
+
+// shouldCompress reports whether the response is eligible for compression
+func (cw *compressWriter) shouldCompress(h http.Header, force bool) bool {
+	if !force && len(cw.buf) < cw.c.minSize {
+		return false
+	}
+
+	switch {
+	case cw.status < 200,
+		cw.status == http.StatusNoContent,
+		cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	}
+
+	// already encoded or ranged responses are sent as is
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", ct)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return matchMediaType(mediaType, cw.c.contentTypes)
+}
+
+// matchMediaType reports whether the media type is in the list, entries ending in a slash
+// match every subtype
+func matchMediaType(mediaType string, list []string) bool {
+	for _, allowed := range list {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(mediaType, allowed) {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Flush sends any buffered data to the client
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		// flushing sends the header so the encoding has to be chosen now,
+		// streaming responses can't wait for MinSize
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+			cw.rw.committed = true
+		}
+
+		cw.decide(true)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter doesn't support hijacking")
+	}
+
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes any remaining data and returns the encoder to its pool
+func (cw *compressWriter) Close() error {
+	var err error
+	if !cw.decided {
+		// nothing was written so there is nothing to compress
+		if cw.status == 0 {
+			return nil
+		}
+
+		err = cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		if cerr := cw.enc.Close(); err == nil {
+			err = cerr
+		}
+
+		cw.enc.Reset(io.Discard)
+		cw.c.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+
+	return err
+}
@@ -0,0 +1,189 @@
+package nova
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress_Gzip(t *testing.T) {
+	body := strings.Repeat(`{"hello":"world"}`, 200)
+	s := New()
+	s.Use(Compress(CompressOptions{}))
+	s.Get("/test", func(r *Request) error {
+		r.Header().Set("Content-Type", "application/json")
+		return r.Send(body)
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/test", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate;q=0.5")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("expected gzip encoding got %q", res.Header.Get("Content-Encoding"))
+	}
+
+	if res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected Vary Accept-Encoding got %q", res.Header.Get("Vary"))
+	}
+
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(gr)
+	if string(data) != body {
+		t.Error("decompressed body doesn't match")
+	}
+}
+
+func TestCompress_Brotli(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+	s := New()
+	s.Use(Compress(CompressOptions{}))
+	s.Get("/test", func(r *Request) error {
+		return r.Send(body)
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/test", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Encoding") != EncodingBrotli {
+		t.Fatalf("expected br encoding got %q", res.Header.Get("Content-Encoding"))
+	}
+
+	data, _ := ioutil.ReadAll(brotli.NewReader(res.Body))
+	if string(data) != body {
+		t.Error("decompressed body doesn't match")
+	}
+}
+
+func TestCompress_Skipped(t *testing.T) {
+	s := New()
+	s.Use(Compress(CompressOptions{}))
+	s.Get("/small", func(r *Request) error {
+		return r.Send("tiny")
+	})
+	s.Get("/image", func(r *Request) error {
+		r.Header().Set("Content-Type", "image/png")
+		return r.Send(strings.Repeat("a", 4096))
+	})
+	s.Get("/encoded", func(r *Request) error {
+		r.Header().Set("Content-Type", "text/plain")
+		r.Header().Set("Content-Encoding", EncodingGzip)
+		return r.Send(strings.Repeat("a", 4096))
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, endpoint := range []string{"/small", "/image", "/encoded"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+endpoint, nil)
+		req.Header.Set("Accept-Encoding", "deflate")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.Header.Get("Content-Encoding") == EncodingDeflate {
+			t.Errorf("%s shouldn't have been compressed", endpoint)
+		}
+	}
+}
+
+func TestCompress_ErrorAfterWrite(t *testing.T) {
+	s := New()
+	s.Use(Compress(CompressOptions{}))
+	s.Get("/", func(r *Request) error {
+		r.Send("partial")
+		if !r.HeaderWritten() {
+			t.Error("expected the header to be reported as written once the handler has written")
+		}
+
+		return &PayloadTooLargeError{Limit: 1}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", EncodingGzip)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("expected the error func not to add to the buffered response got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCompress_FlushBeforeWrite(t *testing.T) {
+	body := strings.Repeat("data: hello\n\n", 200)
+	s := New()
+	s.Use(Compress(CompressOptions{}))
+	s.Get("/events", func(r *Request) error {
+		r.Header().Set("Content-Type", "text/plain")
+		r.ResponseWriter.(http.Flusher).Flush()
+		return r.Send(body)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", EncodingGzip)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	// the recorder keeps the header as it was when it was sent
+	res := w.Result()
+	if res.Header.Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("expected the flushed header to include the encoding got %v", res.Header)
+	}
+
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(gr)
+	if string(data) != body {
+		t.Error("decompressed body doesn't match")
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	tests := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    EncodingGzip,
+		"gzip, br":                EncodingBrotli,
+		"gzip;q=1, br;q=0.5":      EncodingGzip,
+		"*":                       EncodingBrotli,
+		"*, br;q=0":               EncodingGzip,
+		"deflate, gzip;q=0":       EncodingDeflate,
+		"GZIP;q=0.2, deflate;q=0": EncodingGzip,
+	}
+
+	for header, expected := range tests {
+		if got := negotiateEncoding(header, supported); got != expected {
+			t.Errorf("%q expected %q got %q", header, expected, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package nova
+
+import (
+	"context"
+	"time"
+)
+
+// Key is a typed key for values stored on a Request. Create keys with NewKey and share them
+// between the middleware that sets a value and the handlers that read it.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new unique key for values of type T. The name is only used for debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key
+func (k *Key[T]) String() string {
+	return "nova key " + k.name
+}
+
+// Set stores val on the request's context under key
+func Set[T any](r *Request, key *Key[T], val T) {
+	r.Request = r.Request.WithContext(context.WithValue(r.Context(), key, val))
+}
+
+// Get returns the value stored on the request under key and whether it was set
+func Get[T any](r *Request, key *Key[T]) (T, bool) {
+	val, ok := r.Context().Value(key).(T)
+	return val, ok
+}
+
+// MustGet returns the value stored on the request under key and panics if it wasn't set
+func MustGet[T any](r *Request, key *Key[T]) T {
+	val, ok := Get(r, key)
+	if !ok {
+		panic(key.String() + " not set on request")
+	}
+
+	return val
+}
+
+// Done returns a channel that's closed when the client disconnects or the request times out
+func (r *Request) Done() <-chan struct{} {
+	return r.Context().Done()
+}
+
+// Canceled reports whether the client has gone away or the request has timed out,
+// handlers can check it to stop work early
+func (r *Request) Canceled() bool {
+	return r.Context().Err() != nil
+}
+
+// SetTimeout cancels the request's context after d. Returning the context's error from the
+// handler responds with 503 Service Unavailable.
+func (r *Request) SetTimeout(d time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	r.Request = r.Request.WithContext(ctx)
+	r.OnFinish(cancel)
+}
+
+// Run calls fn in its own goroutine and waits for it to return or for the request to be
+// canceled, whichever is first. fn should stop work when its context is done.
+func Run[T any](r *Request, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx := r.Context()
+	type result struct {
+		val T
+		err error
+	}
+
+	// buffered so fn can finish after we've stopped waiting
+	done := make(chan result, 1)
+	go func() {
+		val, err := fn(ctx)
+		done <- result{val, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.val, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
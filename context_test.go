@@ -0,0 +1,76 @@
+package nova
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequest_SetGet(t *testing.T) {
+	userKey := NewKey[string]("user")
+	idKey := NewKey[int]("id")
+
+	s := New()
+	s.Use(func(req *Request, next func()) {
+		Set(req, userKey, "nova")
+		next()
+	})
+
+	s.Get("/test", func(r *Request) error {
+		if user, ok := Get(r, userKey); !ok || user != "nova" {
+			t.Errorf("expected user nova got %q", user)
+		}
+
+		if _, ok := Get(r, idKey); ok {
+			t.Error("id shouldn't be set")
+		}
+
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestRequest_SetTimeout(t *testing.T) {
+	s := New()
+	s.Get("/test", func(r *Request) error {
+		r.SetTimeout(10 * time.Millisecond)
+
+		_, err := Run(r, func(ctx context.Context) (string, error) {
+			select {
+			case <-time.After(5 * time.Second):
+				return "too slow", nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		})
+
+		if !r.Canceled() {
+			t.Error("request should be canceled")
+		}
+
+		return err
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,299 @@
+package nova
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxCookieSize is the largest cookie browsers are required to store
+const maxCookieSize = 4096
+
+// ErrInvalidCookie is returned when a signed or encrypted cookie has been tampered with, has expired
+// or was encoded with a key that's no longer used
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// CookieOptions configures a cookie. The zero value is a session cookie for every path that's
+// HttpOnly, Secure and SameSite=Lax.
+type CookieOptions struct {
+	Path   string
+	Domain string
+
+	// MaxAge is how long the cookie is kept, 0 keeps it until the browser closes
+	MaxAge time.Duration
+
+	// SameSite defaults to http.SameSiteLaxMode
+	SameSite http.SameSite
+
+	// Insecure allows the cookie to be sent over plain HTTP
+	Insecure bool
+
+	// AllowScript lets scripts read the cookie
+	AllowScript bool
+}
+
+// cookie builds the cookie with the options applied
+func (o CookieOptions) cookie(name, value string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		SameSite: o.SameSite,
+		Secure:   !o.Insecure,
+		HttpOnly: !o.AllowScript,
+	}
+
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+
+	if o.MaxAge > 0 {
+		c.MaxAge = int(o.MaxAge / time.Second)
+		c.Expires = time.Now().Add(o.MaxAge)
+	}
+
+	return c
+}
+
+// SetCookie adds a cookie to the response
+func (r *Request) SetCookie(name, value string, opts CookieOptions) {
+	http.SetCookie(r.ResponseWriter, opts.cookie(name, value))
+}
+
+// CookieValue returns the value of the named cookie or http.ErrNoCookie if it wasn't sent
+func (r *Request) CookieValue(name string) (string, error) {
+	c, err := r.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Value, nil
+}
+
+// DeleteCookie tells the browser to remove a cookie, the path and domain must match the ones it was set with
+func (r *Request) DeleteCookie(name string, opts CookieOptions) {
+	c := opts.cookie(name, "")
+	c.MaxAge = -1
+	c.Expires = time.Unix(0, 0)
+	http.SetCookie(r.ResponseWriter, c)
+}
+
+// CookieCodec protects cookie values. The cookie name is bound to the value so it can't be
+// copied into another cookie. Values don't expire unless the codec is wrapped with ExpiringCookieCodec,
+// the cookie's MaxAge only tells the browser when to remove it.
+type CookieCodec interface {
+	Encode(name, value string) (string, error)
+	Decode(name, encoded string) (string, error)
+}
+
+// SetSecureCookie encodes the value with the codec and adds the cookie to the response
+func (r *Request) SetSecureCookie(codec CookieCodec, name, value string, opts CookieOptions) error {
+	encoded, err := codec.Encode(name, value)
+	if err != nil {
+		return err
+	}
+
+	r.SetCookie(name, encoded, opts)
+	return nil
+}
+
+// SecureCookie returns the decoded value of a cookie set with SetSecureCookie. It returns
+// http.ErrNoCookie if it wasn't sent and ErrInvalidCookie if it can't be decoded.
+func (r *Request) SecureCookie(codec CookieCodec, name string) (string, error) {
+	encoded, err := r.CookieValue(name)
+	if err != nil {
+		return "", err
+	}
+
+	return codec.Decode(name, encoded)
+}
+
+// signer signs cookies with HMAC-SHA256
+type signer struct {
+	keys [][]byte
+}
+
+// NewCookieSigner returns a codec that signs values so they can be read but not changed by the client.
+// The first key signs and every key verifies so keys can be rotated by adding a new key first.
+// Keys must be at least 32 bytes.
+func NewCookieSigner(keys ...[]byte) (CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cookie signer needs a key")
+	}
+
+	for _, k := range keys {
+		if len(k) < 32 {
+			return nil, errors.New("cookie signing keys must be at least 32 bytes")
+		}
+	}
+
+	return &signer{keys: keys}, nil
+}
+
+// mac returns the signature of the name and encoded value with key
+func (s *signer) mac(key []byte, name, value string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(name))
+	m.Write([]byte{'|'})
+	m.Write([]byte(value))
+	return m.Sum(nil)
+}
+
+// Encode implements CookieCodec
+func (s *signer) Encode(name, value string) (string, error) {
+	v := base64.RawURLEncoding.EncodeToString([]byte(value))
+	encoded := v + "." + base64.RawURLEncoding.EncodeToString(s.mac(s.keys[0], name, v))
+	return checkCookieSize(name, encoded)
+}
+
+// Decode implements CookieCodec
+func (s *signer) Decode(name, encoded string) (string, error) {
+	dot := strings.LastIndexByte(encoded, '.')
+	if dot < 0 {
+		return "", ErrInvalidCookie
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encoded[dot+1:])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	v := encoded[:dot]
+	for _, k := range s.keys {
+		if hmac.Equal(sig, s.mac(k, name, v)) {
+			value, err := base64.RawURLEncoding.DecodeString(v)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+
+			return string(value), nil
+		}
+	}
+
+	return "", ErrInvalidCookie
+}
+
+// encrypter encrypts cookies with AES-GCM
+type encrypter struct {
+	aeads []cipher.AEAD
+}
+
+// NewCookieEncrypter returns a codec that encrypts values so they can't be read or changed by the client.
+// The first key encrypts and every key decrypts so keys can be rotated by adding a new key first.
+// Keys must be 16, 24 or 32 bytes to use AES-128, AES-192 or AES-256.
+func NewCookieEncrypter(keys ...[]byte) (CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cookie encrypter needs a key")
+	}
+
+	e := &encrypter{}
+	for _, k := range keys {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cookie encryption key")
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cookie encryption key")
+		}
+
+		e.aeads = append(e.aeads, aead)
+	}
+
+	return e, nil
+}
+
+// Encode implements CookieCodec
+func (e *encrypter) Encode(name, value string) (string, error) {
+	aead := e.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "couldn't create nonce")
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return checkCookieSize(name, base64.RawURLEncoding.EncodeToString(sealed))
+}
+
+// Decode implements CookieCodec
+func (e *encrypter) Decode(name, encoded string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, aead := range e.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+
+		value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return string(value), nil
+		}
+	}
+
+	return "", ErrInvalidCookie
+}
+
+// expiringCodec adds the time values were encoded so old values can be rejected
+type expiringCodec struct {
+	codec  CookieCodec
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// ExpiringCookieCodec returns a codec that adds the time a value is encoded and rejects values older
+// than maxAge with ErrInvalidCookie, so a captured cookie can't be used forever
+func ExpiringCookieCodec(codec CookieCodec, maxAge time.Duration) CookieCodec {
+	return &expiringCodec{codec: codec, maxAge: maxAge, now: time.Now}
+}
+
+// Encode implements CookieCodec
+func (e *expiringCodec) Encode(name, value string) (string, error) {
+	return e.codec.Encode(name, strconv.FormatInt(e.now().Unix(), 10)+"|"+value)
+}
+
+// Decode implements CookieCodec
+func (e *expiringCodec) Decode(name, encoded string) (string, error) {
+	v, err := e.codec.Decode(name, encoded)
+	if err != nil {
+		return "", err
+	}
+
+	bar := strings.IndexByte(v, '|')
+	if bar < 0 {
+		return "", ErrInvalidCookie
+	}
+
+	issued, err := strconv.ParseInt(v[:bar], 10, 64)
+	if err != nil || e.now().Sub(time.Unix(issued, 0)) > e.maxAge {
+		return "", ErrInvalidCookie
+	}
+
+	return v[bar+1:], nil
+}
+
+// checkCookieSize returns an error if the cookie is too large for browsers to store
+func checkCookieSize(name, encoded string) (string, error) {
+	if len(name)+len(encoded) > maxCookieSize {
+		return "", errors.Errorf("cookie %s is larger than %d bytes", name, maxCookieSize)
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,156 @@
+package nova
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetCookie(t *testing.T) {
+	s := New()
+	s.Get("/", func(req *Request) error {
+		v, err := req.CookieValue("theme")
+		if err != nil {
+			return req.Send("none")
+		}
+
+		req.SetCookie("seen", v, CookieOptions{MaxAge: time.Hour})
+		req.DeleteCookie("theme", CookieOptions{})
+		return req.Send(v)
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Body.String() != "none" {
+		t.Errorf("expected no cookie got %q", w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies got %v", cookies)
+	}
+
+	seen := cookies[0]
+	if seen.Value != "dark" || !seen.HttpOnly || !seen.Secure || seen.SameSite != http.SameSiteLaxMode ||
+		seen.Path != "/" || seen.MaxAge != 3600 {
+		t.Errorf("expected a secure cookie got %+v", seen)
+	}
+
+	if cookies[1].Name != "theme" || cookies[1].MaxAge != -1 {
+		t.Errorf("expected the theme cookie to be deleted got %+v", cookies[1])
+	}
+}
+
+func TestSecureCookies(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	for name, newCodec := range map[string]func(keys ...[]byte) (CookieCodec, error){
+		"signed":    NewCookieSigner,
+		"encrypted": NewCookieEncrypter,
+	} {
+		old, err := newCodec(oldKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotated, _ := newCodec(newKey, oldKey)
+		retired, _ := newCodec(newKey)
+
+		encoded, err := old.Encode("cart", "item=42")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "encrypted" && strings.Contains(encoded, "aXRlbT00Mg") {
+			t.Error("expected the encrypted value not to contain the plain value")
+		}
+
+		if v, err := rotated.Decode("cart", encoded); err != nil || v != "item=42" {
+			t.Errorf("%s expected a rotated codec to decode old cookies got %q %v", name, v, err)
+		}
+
+		if _, err := retired.Decode("cart", encoded); err != ErrInvalidCookie {
+			t.Errorf("%s expected a retired key to be rejected got %v", name, err)
+		}
+
+		if _, err := old.Decode("session", encoded); err != ErrInvalidCookie {
+			t.Errorf("%s expected a value moved to another cookie to be rejected got %v", name, err)
+		}
+
+		tampered := []byte(encoded)
+		tampered[2] ^= 1
+		if _, err := old.Decode("cart", string(tampered)); err != ErrInvalidCookie {
+			t.Errorf("%s expected a tampered value to be rejected got %v", name, err)
+		}
+
+		if _, err := old.Encode("big", strings.Repeat("x", maxCookieSize)); err == nil {
+			t.Errorf("%s expected oversized cookies to fail", name)
+		}
+	}
+
+	if _, err := NewCookieSigner([]byte("short")); err == nil {
+		t.Error("expected short signing keys to fail")
+	}
+
+	codec, _ := NewCookieEncrypter(newKey)
+	s := New()
+	s.Get("/set", func(req *Request) error {
+		return req.SetSecureCookie(codec, "prefs", "lang=en", CookieOptions{})
+	})
+	s.Get("/get", func(req *Request) error {
+		v, err := req.SecureCookie(codec, "prefs")
+		if err != nil {
+			return err
+		}
+
+		return req.Send(v)
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/set", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Body.String() != "lang=en" {
+		t.Errorf("expected the decrypted cookie got %q", w.Body.String())
+	}
+}
+
+func TestExpiringCookieCodec(t *testing.T) {
+	signer, _ := NewCookieSigner(bytes.Repeat([]byte{1}, 32))
+	codec := ExpiringCookieCodec(signer, time.Hour).(*expiringCodec)
+	now := time.Now()
+	codec.now = func() time.Time { return now }
+
+	encoded, err := codec.Encode("remember", "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Minute)
+	if v, err := codec.Decode("remember", encoded); err != nil || v != "user-1" {
+		t.Errorf("expected the value within its max age got %q %v", v, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := codec.Decode("remember", encoded); err != ErrInvalidCookie {
+		t.Errorf("expected an expired value to be rejected got %v", err)
+	}
+
+	// values encoded without the time aren't accepted
+	plain, _ := signer.Encode("remember", "user-1")
+	if _, err := codec.Decode("remember", plain); err != ErrInvalidCookie {
+		t.Errorf("expected a value without a time to be rejected got %v", err)
+	}
+}
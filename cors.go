@@ -0,0 +1,253 @@
+package nova
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS request and response headers
+const (
+	HeaderOrigin                        = "Origin"
+	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+// CORSOptions configures which cross origin requests browsers allow
+type CORSOptions struct {
+	// AllowOrigins lists the allowed origins such as https://example.com. An entry of * allows every origin
+	// and a * in place of a subdomain such as https://*.example.com allows any subdomain.
+	AllowOrigins []string
+
+	// AllowOriginPatterns allows origins matching any of the expressions
+	AllowOriginPatterns []*regexp.Regexp
+
+	// AllowOriginFunc allows origins it returns true for
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods lists the allowed methods, defaults to the methods registered for the requested path
+	AllowMethods []string
+
+	// AllowHeaders lists the request headers that can be sent, defaults to the headers the preflight asks for
+	AllowHeaders []string
+
+	// ExposeHeaders lists the response headers scripts can read
+	ExposeHeaders []string
+
+	// AllowCredentials allows cookies and authorization headers to be sent
+	AllowCredentials bool
+
+	// MaxAge is how long browsers can cache a preflight response
+	MaxAge time.Duration
+}
+
+// corsPolicy is the compiled form of CORSOptions
+type corsPolicy struct {
+	opts      CORSOptions
+	anyOrigin bool
+	exact     map[string]bool
+	wildcard  [][2]string
+}
+
+// EnableCORS answers preflight requests and adds CORS headers to responses for every route.
+// Route groups can use their own policy with RouteGroup.CORS.
+func (sn *Server) EnableCORS(opts CORSOptions) {
+	sn.cors = newCORSPolicy(opts)
+	sn.corsUsed = true
+}
+
+// CORS sets the CORS policy for routes added to the group after it's called
+func (r *RouteGroup) CORS(opts CORSOptions) *RouteGroup {
+	r.cors = newCORSPolicy(opts)
+	r.s.corsUsed = true
+	return r
+}
+
+func newCORSPolicy(opts CORSOptions) *corsPolicy {
+	p := &corsPolicy{opts: opts, exact: map[string]bool{}}
+	for _, o := range opts.AllowOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			p.anyOrigin = true
+		case strings.Contains(o, "*"):
+			i := strings.Index(o, "*")
+			p.wildcard = append(p.wildcard, [2]string{o[:i], o[i+1:]})
+		default:
+			p.exact[o] = true
+		}
+	}
+
+	return p
+}
+
+// allowOrigin reports whether the origin is allowed
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if p.exact[lower] {
+		return true
+	}
+
+	for _, w := range p.wildcard {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+
+	for _, re := range p.opts.AllowOriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return p.opts.AllowOriginFunc != nil && p.opts.AllowOriginFunc(origin)
+}
+
+// setOrigin sets the allow origin header, returning false if the origin isn't allowed.
+// A policy allowing every origin without credentials sends * so responses can be cached for every origin.
+func (p *corsPolicy) setOrigin(h http.Header, origin string) bool {
+	if p.anyOrigin && !p.opts.AllowCredentials {
+		h.Set(HeaderAccessControlAllowOrigin, "*")
+		return true
+	}
+
+	// the response depends on the origin even when it isn't allowed
+	addVary(h, HeaderOrigin)
+	if !p.allowOrigin(origin) {
+		return false
+	}
+
+	h.Set(HeaderAccessControlAllowOrigin, origin)
+	if p.opts.AllowCredentials {
+		h.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+
+	return true
+}
+
+// apply adds the CORS headers for an actual request, replacing any set by another policy
+func (p *corsPolicy) apply(r *Request) {
+	origin := r.Request.Header.Get(HeaderOrigin)
+	if origin == "" {
+		return
+	}
+
+	h := r.Header()
+	h.Del(HeaderAccessControlAllowOrigin)
+	h.Del(HeaderAccessControlAllowCredentials)
+	h.Del(HeaderAccessControlExposeHeaders)
+
+	if p.setOrigin(h, origin) && len(p.opts.ExposeHeaders) > 0 {
+		h.Set(HeaderAccessControlExposeHeaders, strings.Join(p.opts.ExposeHeaders, ", "))
+	}
+}
+
+// preflight responds to a preflight request without calling the route
+func (p *corsPolicy) preflight(r *Request, methods []string) {
+	h := r.Header()
+	addVary(h, HeaderAccessControlRequestMethod)
+	addVary(h, HeaderAccessControlRequestHeaders)
+
+	if p.setOrigin(h, r.Request.Header.Get(HeaderOrigin)) {
+		if len(p.opts.AllowMethods) > 0 {
+			methods = p.opts.AllowMethods
+		}
+
+		if len(methods) > 0 {
+			h.Set(HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+		}
+
+		if len(p.opts.AllowHeaders) > 0 {
+			h.Set(HeaderAccessControlAllowHeaders, strings.Join(p.opts.AllowHeaders, ", "))
+		} else if req := r.Request.Header.Values(HeaderAccessControlRequestHeaders); len(req) > 0 {
+			h.Set(HeaderAccessControlAllowHeaders, strings.Join(req, ", "))
+		}
+
+		if p.opts.MaxAge > 0 {
+			h.Set(HeaderAccessControlMaxAge, strconv.Itoa(int(p.opts.MaxAge.Seconds())))
+		}
+	}
+
+	r.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// isPreflight reports whether the request is a CORS preflight
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get(HeaderOrigin) != "" &&
+		r.Header.Get(HeaderAccessControlRequestMethod) != ""
+}
+
+// handlePreflight answers a preflight with the policy of the route it's for and reports whether it did.
+// Preflights for paths without a policy are routed as normal.
+func (sn *Server) handlePreflight(r *Request) bool {
+	path := cleanPath(r.URL.Path)
+	methods, routes := sn.methodsFor(path)
+
+	policy := sn.cors
+	if route := sn.climbTree(r.Request.Header.Get(HeaderAccessControlRequestMethod), path); route != nil && route.options().cors != nil {
+		policy = route.options().cors
+	} else if policy == nil {
+		// use a group policy if the path is registered for another method
+		for _, route := range routes {
+			if cors := route.options().cors; cors != nil {
+				policy = cors
+				break
+			}
+		}
+	}
+
+	if policy == nil {
+		return false
+	}
+
+	policy.preflight(r, methods)
+	return true
+}
+
+// corsMethods are the methods allowed for routes registered with All
+var corsMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// methodsFor returns the methods with a route matching path along with the matched routes
+func (sn *Server) methodsFor(path string) ([]string, []*Route) {
+	parts := strings.Split(path, "/")
+	var methods []string
+	var routes []*Route
+	for method, node := range sn.loadPaths() {
+		route := node.match(parts)
+		if route == nil {
+			continue
+		}
+
+		routes = append(routes, route)
+		if method == "" {
+			methods = append(methods, corsMethods...)
+		} else {
+			methods = append(methods, method)
+		}
+	}
+
+	sort.Strings(methods)
+	unique := methods[:0]
+	for i, m := range methods {
+		if i == 0 || m != methods[i-1] {
+			unique = append(unique, m)
+		}
+	}
+
+	return unique, routes
+}
@@ -0,0 +1,121 @@
+package nova
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func corsRequest(s *Server, method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set(HeaderOrigin, origin)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	s := New()
+	s.EnableCORS(CORSOptions{
+		AllowOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+		AllowCredentials:    true,
+		MaxAge:              10 * time.Minute,
+	})
+	s.Use(func(req *Request, next func()) {
+		called = true
+		next()
+	})
+	s.Get("/users/:id", func(req *Request) error {
+		return nil
+	})
+	s.Delete("/users/:id", func(req *Request) error {
+		return nil
+	})
+
+	preflight := map[string]string{
+		HeaderAccessControlRequestMethod:  http.MethodDelete,
+		HeaderAccessControlRequestHeaders: "Authorization",
+	}
+
+	for _, origin := range []string{"https://app.example.com", "https://eu.example.org", "http://localhost:3000"} {
+		w := corsRequest(s, http.MethodOptions, "/users/1", origin, preflight)
+		if w.Code != http.StatusNoContent || w.Header().Get(HeaderAccessControlAllowOrigin) != origin {
+			t.Errorf("expected %s to be allowed got %d %v", origin, w.Code, w.Header())
+		}
+
+		if w.Header().Get(HeaderAccessControlAllowMethods) != "DELETE, GET" {
+			t.Errorf("expected methods from the route tree got %q", w.Header().Get(HeaderAccessControlAllowMethods))
+		}
+
+		if w.Header().Get(HeaderAccessControlAllowHeaders) != "Authorization" ||
+			w.Header().Get(HeaderAccessControlAllowCredentials) != "true" ||
+			w.Header().Get(HeaderAccessControlMaxAge) != "600" {
+			t.Errorf("unexpected preflight headers %v", w.Header())
+		}
+	}
+
+	if called {
+		t.Error("expected preflight not to run middleware")
+	}
+
+	w := corsRequest(s, http.MethodOptions, "/users/1", "https://evil.com", preflight)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "" || w.Header().Get("Vary") == "" {
+		t.Errorf("expected disallowed origin to get no CORS headers but a Vary got %v", w.Header())
+	}
+
+	w = corsRequest(s, http.MethodOptions, "/users/1", "https://example.org", preflight)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Error("expected wildcard to require a subdomain")
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	s := New()
+	s.EnableCORS(CORSOptions{AllowOrigins: []string{"*"}, ExposeHeaders: []string{"X-Total"}})
+	s.Group("/internal").
+		CORS(CORSOptions{AllowOrigins: []string{"https://admin.example.com"}}).
+		Get("/stats", func(req *Request) error {
+			return nil
+		})
+	s.Get("/public", func(req *Request) error {
+		return nil
+	})
+
+	w := corsRequest(s, http.MethodGet, "/public", "https://any.com", nil)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "*" || w.Header().Get(HeaderAccessControlExposeHeaders) != "X-Total" {
+		t.Errorf("expected public CORS headers got %v", w.Header())
+	}
+
+	w = corsRequest(s, http.MethodGet, "/internal/stats", "https://any.com", nil)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "" || w.Header().Get("Vary") != HeaderOrigin {
+		t.Errorf("expected group policy to reject origin got %v", w.Header())
+	}
+
+	w = corsRequest(s, http.MethodGet, "/internal/stats", "https://admin.example.com", nil)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "https://admin.example.com" {
+		t.Errorf("expected group policy to allow origin got %v", w.Header())
+	}
+
+	w = corsRequest(s, http.MethodOptions, "/internal/stats", "https://admin.example.com", map[string]string{
+		HeaderAccessControlRequestMethod: http.MethodGet,
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get(HeaderAccessControlAllowMethods) != "GET" {
+		t.Errorf("expected group preflight got %d %v", w.Code, w.Header())
+	}
+
+	w = corsRequest(s, http.MethodGet, "/public", "", nil)
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Error("expected no CORS headers without an Origin")
+	}
+}
@@ -0,0 +1,130 @@
+package nova
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDecompressMaxSize is the largest decompressed body allowed when no MaxSize is configured
+const DefaultDecompressMaxSize = 10 << 20
+
+// DecompressOptions configures the request decompression middleware
+type DecompressOptions struct {
+	// MaxSize is the maximum number of decompressed bytes that can be read from the body,
+	// 0 uses DefaultDecompressMaxSize
+	MaxSize int64
+}
+
+// Decompress returns middleware that transparently decodes gzip and deflate request bodies
+// so ReadJSON and other readers see the plain body. Requests using any other encoding are
+// rejected with 415 Unsupported Media Type. Register it with Server.Use.
+func Decompress(opts DecompressOptions) func(*Request, func()) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultDecompressMaxSize
+	}
+
+	return func(req *Request, next func()) {
+		encodings := req.Request.Header.Values("Content-Encoding")
+		if len(encodings) == 0 || req.Request.Body == nil || req.Request.Body == http.NoBody {
+			next()
+			return
+		}
+
+		body, err := decodeBody(req.Request.Body, encodings)
+		if err != nil {
+			code := http.StatusBadRequest
+			if _, ok := errors.Cause(err).(unsupportedEncodingError); ok {
+				code = http.StatusUnsupportedMediaType
+			}
+
+			req.Error(code, err.Error(), err)
+			return
+		}
+
+		req.Request.Body = newMaxReader(body, closers{body, req.Request.Body}, maxSize)
+		req.Request.ContentLength = -1
+		req.Request.Header.Del("Content-Length")
+		req.Request.Header.Del("Content-Encoding")
+
+		next()
+	}
+}
+
+// unsupportedEncodingError is returned for a Content-Encoding we can't decode
+type unsupportedEncodingError string
+
+// Error implements the error interface
+func (e unsupportedEncodingError) Error() string {
+	return "unsupported content encoding " + string(e)
+}
+
+// decodeBody undoes each of the content encodings in the reverse order they were applied
+func decodeBody(body io.ReadCloser, headers []string) (io.ReadCloser, error) {
+	var encodings []string
+	for _, h := range headers {
+		for _, enc := range strings.Split(h, ",") {
+			enc = strings.ToLower(strings.TrimSpace(enc))
+			if enc != "" && enc != "identity" {
+				encodings = append(encodings, enc)
+			}
+		}
+	}
+
+	var r io.ReadCloser = io.NopCloser(body)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch encodings[i] {
+		case EncodingGzip, "x-gzip":
+			r, err = gzip.NewReader(r)
+		case EncodingDeflate:
+			r, err = newDeflateReader(r)
+		default:
+			return nil, unsupportedEncodingError(encodings[i])
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode request body")
+		}
+	}
+
+	return r, nil
+}
+
+// newDeflateReader reads zlib wrapped deflate data as specified by HTTP, falling back to raw
+// deflate which some clients send instead
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
+
+// closers closes each of the closers in order returning the first error
+type closers []io.Closer
+
+// Close implements io.Closer
+func (c closers) Close() error {
+	var err error
+	for _, closer := range c {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
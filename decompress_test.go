@@ -0,0 +1,120 @@
+package nova
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func gzipBytes(data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(data))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	s := New()
+	s.Use(Decompress(DecompressOptions{}))
+	s.Post("/test", func(r *Request) error {
+		var body struct {
+			Hello string
+		}
+
+		if err := r.ReadJSON(&body); err != nil {
+			t.Error(err)
+		}
+
+		return r.Send(body.Hello)
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write([]byte(`{"Hello": "deflate"}`))
+	zw.Close()
+
+	tests := map[string][]byte{
+		EncodingGzip:    gzipBytes(`{"Hello": "gzip"}`),
+		EncodingDeflate: deflated.Bytes(),
+	}
+
+	for encoding, body := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/test", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", encoding)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		buf.ReadFrom(res.Body)
+		res.Body.Close()
+
+		if buf.String() != encoding {
+			t.Errorf("expected %s got %s", encoding, buf.String())
+		}
+	}
+}
+
+func TestDecompress_MaxSize(t *testing.T) {
+	s := New()
+	s.Use(Decompress(DecompressOptions{MaxSize: 1024}))
+	s.Post("/test", func(r *Request) error {
+		var buf bytes.Buffer
+		_, err := buf.ReadFrom(r.Body)
+		if _, ok := errors.Cause(err).(*PayloadTooLargeError); !ok {
+			t.Errorf("expected PayloadTooLargeError got %v", err)
+		}
+
+		if buf.Len() != 1024 {
+			t.Errorf("expected 1024 bytes read got %d", buf.Len())
+		}
+
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/test", bytes.NewReader(gzipBytes(strings.Repeat("a", 1<<20))))
+	req.Header.Set("Content-Encoding", EncodingGzip)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestDecompress_Unsupported(t *testing.T) {
+	s := New()
+	s.Use(Decompress(DecompressOptions{}))
+	s.Post("/test", func(r *Request) error {
+		t.Error("handler shouldn't be reached")
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/test", strings.NewReader("data"))
+	req.Header.Set("Content-Encoding", "compress")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,239 @@
+package nova
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// health statuses following the IETF health check response format
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+// DefaultHealthTimeout is how long a check can run when it has no timeout
+const DefaultHealthTimeout = 5 * time.Second
+
+// HealthCheck reports an error if the dependency it checks isn't healthy
+type HealthCheck func(ctx context.Context) error
+
+// CheckOptions configures a registered health check
+type CheckOptions struct {
+	// Timeout is how long the check can run, defaults to DefaultHealthTimeout
+	Timeout time.Duration
+
+	// Critical checks fail readiness when they fail, other checks only report a warning
+	Critical bool
+
+	// Liveness includes the check in liveness as well as readiness
+	Liveness bool
+}
+
+// HealthOptions configures a Health
+type HealthOptions struct {
+	// CacheTTL is how long check results are reused before the check is run again, 0 always runs them
+	CacheTTL time.Duration
+}
+
+// Health runs registered checks and exposes liveness and readiness endpoints
+type Health struct {
+	cacheTTL     time.Duration
+	mu           sync.RWMutex
+	checks       map[string]*healthCheck
+	shuttingDown int32
+}
+
+// healthCheck is a registered check and its cached result
+type healthCheck struct {
+	name  string
+	check HealthCheck
+	opts  CheckOptions
+
+	// held while running so concurrent requests share one run
+	mu     sync.Mutex
+	result CheckResult
+	ran    time.Time
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status   string    `json:"status"`
+	Critical bool      `json:"critical"`
+	Duration float64   `json:"duration_ms"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// HealthReport is the body returned by the health endpoints
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// EnableHealth returns the Health for the server, readiness fails once the server starts shutting down.
+// Mount its endpoints with s.Get("/livez", health.Live) and s.Get("/readyz", health.Ready).
+func (sn *Server) EnableHealth(opts HealthOptions) *Health {
+	sn.health = NewHealth(opts)
+	return sn.health
+}
+
+// NewHealth returns a Health with no checks
+func NewHealth(opts HealthOptions) *Health {
+	return &Health{
+		cacheTTL: opts.CacheTTL,
+		checks:   map[string]*healthCheck{},
+	}
+}
+
+// Register adds a named check, registering a name again replaces its check
+func (h *Health) Register(name string, check HealthCheck, opts CheckOptions) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultHealthTimeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = &healthCheck{name: name, check: check, opts: opts}
+}
+
+// SetShuttingDown fails readiness so load balancers stop sending new requests.
+// When serving with your own http.Server register it with RegisterOnShutdown.
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// ShuttingDown reports whether readiness has been failed for shutdown
+func (h *Health) ShuttingDown() bool {
+	return atomic.LoadInt32(&h.shuttingDown) == 1
+}
+
+// Live responds with the result of the liveness checks
+func (h *Health) Live(r *Request) error {
+	report := h.Check(r.Context(), true)
+	return r.JSON(reportStatus(report), report)
+}
+
+// Ready responds with the result of every check, failing while the server is shutting down
+func (h *Health) Ready(r *Request) error {
+	if h.ShuttingDown() {
+		report := HealthReport{Status: HealthFail, Error: "shutting down"}
+		return r.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	report := h.Check(r.Context(), false)
+	return r.JSON(reportStatus(report), report)
+}
+
+// reportStatus returns 503 for a failing report and 200 otherwise
+func reportStatus(report HealthReport) int {
+	if report.Status == HealthFail {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusOK
+}
+
+// Check runs the checks concurrently, only the liveness checks if liveness is set
+func (h *Health) Check(ctx context.Context, liveness bool) HealthReport {
+	h.mu.RLock()
+	checks := make([]*healthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		if !liveness || c.opts.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			results[i] = c.run(ctx, h.cacheTTL)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthPass, Checks: map[string]CheckResult{}}
+	for i, c := range checks {
+		res := results[i]
+		report.Checks[c.name] = res
+		switch {
+		case res.Status == HealthFail && c.opts.Critical:
+			report.Status = HealthFail
+		case res.Status != HealthPass && report.Status == HealthPass:
+			report.Status = HealthWarn
+		}
+	}
+
+	return report
+}
+
+// run returns the cached result or runs the check if it has expired
+func (c *healthCheck) run(ctx context.Context, ttl time.Duration) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ran.IsZero() && time.Since(c.ran) < ttl {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.Errorf("check panicked: %v", p)
+			}
+		}()
+
+		done <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "check timed out")
+	}
+
+	res := CheckResult{
+		Status:   HealthPass,
+		Critical: c.opts.Critical,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Time:     start,
+	}
+
+	if err != nil {
+		res.Status = HealthFail
+		if !c.opts.Critical {
+			res.Status = HealthWarn
+		}
+
+		res.Error = err.Error()
+	}
+
+	// results from a canceled request aren't cached so the next caller runs the check
+	if ctx.Err() == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		c.result = res
+		c.ran = start
+	}
+
+	return res
+}
@@ -0,0 +1,97 @@
+package nova
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getHealth(t *testing.T, url string) (int, HealthReport) {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var report HealthReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, report
+}
+
+func TestHealth(t *testing.T) {
+	var dbDown int32 = 1
+
+	s := New()
+	h := s.EnableHealth(HealthOptions{})
+	h.Register("db", func(ctx context.Context) error {
+		if atomic.LoadInt32(&dbDown) == 1 {
+			return errors.New("connection refused")
+		}
+
+		return nil
+	}, CheckOptions{Critical: true})
+	h.Register("cache", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, CheckOptions{Timeout: 10 * time.Millisecond})
+	h.Register("goroutines", func(ctx context.Context) error {
+		return nil
+	}, CheckOptions{Liveness: true})
+
+	s.Get("/livez", h.Live)
+	s.Get("/readyz", h.Ready)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	code, report := getHealth(t, ts.URL+"/livez")
+	if code != http.StatusOK || len(report.Checks) != 1 {
+		t.Errorf("expected passing liveness with 1 check got %d %+v", code, report)
+	}
+
+	code, report = getHealth(t, ts.URL+"/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthFail {
+		t.Errorf("expected failing readiness got %d %+v", code, report)
+	}
+
+	if report.Checks["cache"].Status != HealthWarn || report.Checks["db"].Error != "connection refused" {
+		t.Errorf("unexpected check results %+v", report.Checks)
+	}
+
+	atomic.StoreInt32(&dbDown, 0)
+	code, report = getHealth(t, ts.URL+"/readyz")
+	if code != http.StatusOK || report.Status != HealthWarn {
+		t.Errorf("expected degraded readiness got %d %+v", code, report)
+	}
+
+	h.SetShuttingDown()
+	code, _ = getHealth(t, ts.URL+"/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail while shutting down got %d", code)
+	}
+}
+
+func TestHealth_Cache(t *testing.T) {
+	var runs int32
+	h := NewHealth(HealthOptions{CacheTTL: time.Minute})
+	h.Register("counted", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, CheckOptions{})
+
+	for i := 0; i < 3; i++ {
+		h.Check(context.Background(), false)
+	}
+
+	if runs != 1 {
+		t.Errorf("expected cached results to be reused, check ran %d times", runs)
+	}
+}
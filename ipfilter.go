@@ -0,0 +1,110 @@
+package nova
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// ForbiddenError is returned when the client isn't allowed to access a route, the default error func
+// responds with 403 Forbidden and the reason
+type ForbiddenError struct {
+	Reason string
+}
+
+// Error implements error
+func (e *ForbiddenError) Error() string {
+	return "forbidden: " + e.Reason
+}
+
+// IPAction is what happens to a client matching an IPRule
+type IPAction int
+
+// ip rule actions
+const (
+	IPAllow IPAction = iota
+	IPDeny
+)
+
+// IPRule allows or denies clients in any of the networks. Networks are CIDRs such as 10.0.0.0/8 or single IPs.
+type IPRule struct {
+	Action   IPAction
+	Networks []string
+}
+
+// IPFilterOptions configures an IPFilter
+type IPFilterOptions struct {
+	// Rules are checked in order and the first that matches the client IP decides
+	Rules []IPRule
+
+	// DefaultAllow allows clients that match no rule, by default they're denied
+	DefaultAllow bool
+}
+
+// IPFilter allows or denies requests by the client IP resolved through trusted proxies.
+// Add it to a group or route with Guard(filter.Check).
+type IPFilter struct {
+	rules atomic.Value
+}
+
+// ipRules is the parsed form of IPFilterOptions
+type ipRules struct {
+	rules        []ipRule
+	defaultAllow bool
+}
+
+type ipRule struct {
+	allow bool
+	nets  []*net.IPNet
+}
+
+// NewIPFilter returns a filter applying the rules
+func NewIPFilter(opts IPFilterOptions) (*IPFilter, error) {
+	f := &IPFilter{}
+	if err := f.Update(opts); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Update replaces the rules, it's safe to call while serving.
+// The current rules are kept if the new ones can't be parsed.
+func (f *IPFilter) Update(opts IPFilterOptions) error {
+	rules := &ipRules{defaultAllow: opts.DefaultAllow}
+	for _, r := range opts.Rules {
+		nets, err := parseCIDRs(r.Networks)
+		if err != nil {
+			return err
+		}
+
+		rules.rules = append(rules.rules, ipRule{allow: r.Action == IPAllow, nets: nets})
+	}
+
+	f.rules.Store(rules)
+	return nil
+}
+
+// Allowed reports whether the rules allow ip
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	rules := f.rules.Load().(*ipRules)
+	if ip == nil {
+		return false
+	}
+
+	for _, r := range rules.rules {
+		if containsIP(r.nets, ip) {
+			return r.allow
+		}
+	}
+
+	return rules.defaultAllow
+}
+
+// Check returns a ForbiddenError if the client IP isn't allowed
+func (f *IPFilter) Check(r *Request) error {
+	if !f.Allowed(net.ParseIP(r.ClientIP())) {
+		return &ForbiddenError{Reason: "client address isn't allowed"}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package nova
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	filter, err := NewIPFilter(IPFilterOptions{Rules: []IPRule{
+		{Action: IPDeny, Networks: []string{"10.1.0.0/16"}},
+		{Action: IPAllow, Networks: []string{"10.0.0.0/8", "2001:db8::/32"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New()
+	if err := s.TrustedProxies("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Group("/admin").Guard(filter.Check).Get("/stats", func(req *Request) error {
+		return req.Send("stats")
+	})
+	s.Get("/public", func(req *Request) error {
+		return nil
+	})
+
+	get := func(path, remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set(HeaderXForwardedFor, forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		remote, forwarded string
+		expected          int
+	}{
+		{"10.2.3.4:1", "", http.StatusOK},
+		{"10.1.3.4:1", "", http.StatusForbidden},
+		{"[2001:db8::5]:1", "", http.StatusOK},
+		{"203.0.113.1:1", "", http.StatusForbidden},
+		{"127.0.0.1:1", "10.2.3.4", http.StatusOK},
+		{"127.0.0.1:1", "203.0.113.1", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		if code := get("/admin/stats", test.remote, test.forwarded); code != test.expected {
+			t.Errorf("%s forwarded for %q expected %d got %d", test.remote, test.forwarded, test.expected, code)
+		}
+	}
+
+	if code := get("/public", "203.0.113.1:1", ""); code != http.StatusOK {
+		t.Errorf("expected routes outside the group to be reachable got %d", code)
+	}
+
+	if err := filter.Update(IPFilterOptions{Rules: []IPRule{{Action: IPAllow, Networks: []string{"bad"}}}}); err == nil {
+		t.Error("expected invalid networks to fail")
+	}
+
+	if err := filter.Update(IPFilterOptions{DefaultAllow: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := get("/admin/stats", "203.0.113.1:1", ""); code != http.StatusOK {
+		t.Errorf("expected reloaded rules to allow every client got %d", code)
+	}
+}
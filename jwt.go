@@ -0,0 +1,671 @@
+package nova
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// DefaultJWKSCacheTTL is how long fetched keys are used before they're fetched again
+const DefaultJWKSCacheTTL = time.Hour
+
+// DefaultJWKSMinRefresh is the least time between fetches triggered by tokens signed with unknown keys
+const DefaultJWKSMinRefresh = time.Minute
+
+// Claims are the decoded claims of a verified JWT
+type Claims map[string]interface{}
+
+// String returns a string claim or "" if it isn't set or isn't a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that's a string or an array of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+
+		return out
+	}
+
+	return nil
+}
+
+// Time returns a NumericDate claim such as exp and whether it was set
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	f, err := n.Float64()
+	if err != nil || math.Abs(f) >= math.MaxInt64 {
+		return time.Time{}, false
+	}
+
+	// split the seconds out so dates past 2262 don't overflow nanoseconds
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+}
+
+// Subject returns the sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// claimsKey is the context key for the claims of the request's JWT
+var claimsKey = NewKey[Claims]("jwt claims")
+
+// Claims returns the claims of the JWT the request was authenticated with or nil
+func (r *Request) Claims() Claims {
+	c, _ := Get(r, claimsKey)
+	return c
+}
+
+// KeySet finds the key that verifies a token
+type KeySet interface {
+	// Key returns the key with the id for the algorithm, kid is empty when the token doesn't name one
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// secretKey is a KeySet of a single HMAC secret
+type secretKey []byte
+
+// SecretKey returns a KeySet verifying HS256 tokens with the secret
+func SecretKey(secret []byte) KeySet {
+	return secretKey(secret)
+}
+
+// Key implements KeySet
+func (k secretKey) Key(_ context.Context, _, alg string) (interface{}, error) {
+	if alg != AlgHS256 {
+		return nil, errors.New("secret keys only verify HS256")
+	}
+
+	return []byte(k), nil
+}
+
+// JWTOptions configures JWT verification
+type JWTOptions struct {
+	// Keys verifies token signatures
+	Keys KeySet
+
+	// Issuer is the required iss claim when set
+	Issuer string
+
+	// Audience must be in the aud claim when set
+	Audience string
+
+	// Leeway allows for clock skew when checking exp and nbf
+	Leeway time.Duration
+
+	// Algorithms lists the accepted algorithms, defaults to every supported algorithm
+	Algorithms []string
+
+	// Realm is sent in the bearer challenge
+	Realm string
+
+	// Principal builds the principal from the claims, defaults to DefaultJWTPrincipal
+	Principal func(Claims) *Principal
+
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// DefaultJWTPrincipal uses sub as the ID, the space separated scope claim or the scp array as
+// scopes and the roles claim as roles
+func DefaultJWTPrincipal(c Claims) *Principal {
+	p := &Principal{ID: c.Subject(), Roles: c.Strings("roles")}
+	if scope := c.String("scope"); scope != "" {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = c.Strings("scp")
+	}
+
+	return p
+}
+
+// jwtAuth authenticates JWT bearer tokens
+type jwtAuth struct {
+	opts JWTOptions
+}
+
+// JWTAuth returns an authenticator for JWT bearer tokens. The token's claims are available
+// from Request.Claims.
+func JWTAuth(opts JWTOptions) Authenticator {
+	if opts.Principal == nil {
+		opts.Principal = DefaultJWTPrincipal
+	}
+
+	return &jwtAuth{opts: opts}
+}
+
+// Authenticate implements Authenticator
+func (a *jwtAuth) Authenticate(r *Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := VerifyJWT(r.Context(), token, a.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	Set(r, claimsKey, claims)
+	p := a.opts.Principal(claims)
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return withScheme(p, "bearer"), nil
+}
+
+// Challenge implements Authenticator
+func (a *jwtAuth) Challenge() string {
+	return (&bearerAuth{realm: a.opts.Realm}).Challenge()
+}
+
+// invalidToken returns an error that wraps ErrInvalidCredentials
+func invalidToken(reason string) error {
+	return errors.Wrap(ErrInvalidCredentials, reason)
+}
+
+// VerifyJWT verifies a compact JWT's signature and registered claims and returns its claims.
+// Errors wrap ErrInvalidCredentials.
+func VerifyJWT(ctx context.Context, token string, opts JWTOptions) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+
+	if !acceptedAlg(header.Alg, opts.Algorithms) {
+		return nil, invalidToken("unsupported algorithm " + header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+
+	key, err := opts.Keys.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, errors.Wrap(invalidToken("no key to verify token"), err.Error())
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+
+	if err := validateClaims(claims, opts); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// acceptedAlg reports whether alg is supported and in the accepted list
+func acceptedAlg(alg string, accepted []string) bool {
+	switch alg {
+	case AlgHS256, AlgRS256, AlgES256, AlgEdDSA:
+	default:
+		return false
+	}
+
+	if len(accepted) == 0 {
+		return true
+	}
+
+	for _, a := range accepted {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment keeping numbers exact
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// verifySignature checks the signature with a key that must be the type the algorithm uses
+func verifySignature(alg string, key interface{}, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	valid := false
+
+	switch alg {
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return invalidToken("key can't verify " + alg)
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		valid = hmac.Equal(sig, mac.Sum(nil))
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalidToken("key can't verify " + alg)
+		}
+
+		valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return invalidToken("key can't verify " + alg)
+		}
+
+		if len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			valid = ecdsa.Verify(pub, digest[:], r, s)
+		}
+	case AlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return invalidToken("key can't verify " + alg)
+		}
+
+		valid = ed25519.Verify(pub, []byte(signed), sig)
+	}
+
+	if !valid {
+		return invalidToken("invalid signature")
+	}
+
+	return nil
+}
+
+// validateClaims checks exp, nbf, iss and aud
+func validateClaims(c Claims, opts JWTOptions) error {
+	now := time.Now()
+	if opts.now != nil {
+		now = opts.now()
+	}
+
+	// a time claim that isn't a number can't be checked so the token is rejected rather than treated as unset
+	for _, name := range []string{"exp", "nbf"} {
+		if _, set := c[name]; set {
+			if _, ok := c.Time(name); !ok {
+				return invalidToken("invalid " + name + " claim")
+			}
+		}
+	}
+
+	if exp, ok := c.Time("exp"); ok && !now.Before(exp.Add(opts.Leeway)) {
+		return invalidToken("token has expired")
+	}
+
+	if nbf, ok := c.Time("nbf"); ok && now.Add(opts.Leeway).Before(nbf) {
+		return invalidToken("token isn't valid yet")
+	}
+
+	if opts.Issuer != "" && c.String("iss") != opts.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+
+	if opts.Audience != "" {
+		for _, aud := range c.Strings("aud") {
+			if aud == opts.Audience {
+				return nil
+			}
+		}
+
+		return invalidToken("unexpected audience")
+	}
+
+	return nil
+}
+
+// JWKSOptions configures how a JWKS is cached
+type JWKSOptions struct {
+	// CacheTTL is how long keys are used before they're fetched again, defaults to DefaultJWKSCacheTTL
+	CacheTTL time.Duration
+
+	// MinRefresh is the least time between fetches for tokens signed with an unknown key,
+	// defaults to DefaultJWKSMinRefresh
+	MinRefresh time.Duration
+
+	// Client fetches URLs, defaults to a client with a 10 second timeout
+	Client *http.Client
+}
+
+// JWKS is a cached JSON Web Key Set. Keys are fetched again once the cache expires or when a token
+// names a key that isn't in the set so signing keys can be rotated. Concurrent requests share a fetch
+// and the cached keys are used until one succeeds.
+type JWKS struct {
+	opts  JWKSOptions
+	fetch func(ctx context.Context) ([]byte, error)
+
+	mu      sync.Mutex
+	keys    []jwk
+	fetched time.Time
+
+	// when the last fetch started and the error it failed with, fetches are at least MinRefresh apart
+	attempted time.Time
+	err       error
+
+	// the fetch in progress if there is one
+	inflight *jwksFetch
+}
+
+// jwksFetch is a fetch shared by the requests waiting for it
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// jwksFetchTimeout bounds fetches as they don't use the context of the request that started them
+const jwksFetchTimeout = 30 * time.Second
+
+// jwk is a parsed JSON Web Key
+type jwk struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// NewJWKSURL returns a key set fetched from a JWKS URL such as an identity provider's jwks_uri
+func NewJWKSURL(url string, opts JWKSOptions) *JWKS {
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return newJWKS(opts, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't fetch JWKS")
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("fetching JWKS returned %d", res.StatusCode)
+		}
+
+		return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	})
+}
+
+// NewJWKSFile returns a key set read from a local JWKS file
+func NewJWKSFile(path string, opts JWKSOptions) *JWKS {
+	return newJWKS(opts, func(context.Context) ([]byte, error) {
+		b, err := os.ReadFile(path)
+		return b, errors.Wrap(err, "couldn't read JWKS")
+	})
+}
+
+func newJWKS(opts JWKSOptions, fetch func(ctx context.Context) ([]byte, error)) *JWKS {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultJWKSCacheTTL
+	}
+
+	if opts.MinRefresh <= 0 {
+		opts.MinRefresh = DefaultJWKSMinRefresh
+	}
+
+	return &JWKS{opts: opts, fetch: fetch}
+}
+
+// Key implements KeySet
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if (s.fetched.IsZero() || time.Since(s.fetched) > s.opts.CacheTTL) && s.canFetch() {
+		err = s.refresh(ctx)
+	}
+
+	if key := s.find(kid, alg); key != nil {
+		return key, nil
+	}
+
+	// an unknown key may have been added by a rotation since the last fetch
+	if err == nil && s.canFetch() {
+		err = s.refresh(ctx)
+		if key := s.find(kid, alg); key != nil {
+			return key, nil
+		}
+	}
+
+	if err == nil {
+		err = s.err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, errors.Errorf("no key %q for %s", kid, alg)
+}
+
+// canFetch reports whether a fetch is in progress or the last started at least MinRefresh ago, s.mu must be held
+func (s *JWKS) canFetch() bool {
+	return s.inflight != nil || time.Since(s.attempted) >= s.opts.MinRefresh
+}
+
+// refresh waits for the keys to be fetched, starting a fetch if none is in progress.
+// s.mu must be held and is released while waiting.
+func (s *JWKS) refresh(ctx context.Context) error {
+	f := s.inflight
+	if f == nil {
+		f = &jwksFetch{done: make(chan struct{})}
+		s.inflight = f
+		s.attempted = time.Now()
+		go s.run(f)
+	}
+
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run fetches the keys, keeping the current keys if it fails
+func (s *JWKS) run(f *jwksFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	b, err := s.fetch(ctx)
+	var keys []jwk
+	if err == nil {
+		keys, err = parseJWKS(b)
+	}
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+		s.fetched = time.Now()
+	}
+	s.err = err
+	s.inflight = nil
+	s.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+}
+
+// find returns the key for kid that can verify alg, without a kid the only usable key is returned
+func (s *JWKS) find(kid, alg string) interface{} {
+	var found interface{}
+	matches := 0
+	for _, k := range s.keys {
+		if (k.alg != "" && k.alg != alg) || !keyFitsAlg(k.key, alg) {
+			continue
+		}
+
+		if kid != "" && k.kid == kid {
+			return k.key
+		}
+
+		matches++
+		found = k.key
+	}
+
+	if kid == "" && matches == 1 {
+		return found
+	}
+
+	return nil
+}
+
+// keyFitsAlg reports whether the key type is used by the algorithm
+func keyFitsAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == AlgHS256
+	case *rsa.PublicKey:
+		return alg == AlgRS256
+	case *ecdsa.PublicKey:
+		return alg == AlgES256
+	case ed25519.PublicKey:
+		return alg == AlgEdDSA
+	}
+
+	return false
+}
+
+// parseJWKS parses the keys in a JWKS skipping any it doesn't support
+func parseJWKS(b []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "invalid JWKS")
+	}
+
+	var keys []jwk
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		switch {
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+
+			key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+				continue
+			}
+
+			// reject points that aren't on the curve
+			if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+				continue
+			}
+
+			key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+
+			key = ed25519.PublicKey(x)
+		case k.Kty == "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				continue
+			}
+
+			key = secret
+		default:
+			continue
+		}
+
+		keys = append(keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,276 @@
+package nova
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signJWT creates a compact token signed with key
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64.EncodeToString(rsaKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64.EncodeToString(edKey.Public().(ed25519.PublicKey))},
+		{"kty": "oct", "kid": "hs", "k": b64.EncodeToString(secret)},
+	}})
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	opts := JWTOptions{
+		Keys:     NewJWKSFile(path, JWKSOptions{}),
+		Issuer:   "https://id.example.com",
+		Audience: "orders",
+		Leeway:   30 * time.Second,
+		now:      func() time.Time { return now },
+	}
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "user-1", "iss": "https://id.example.com", "aud": []string{"orders", "billing"},
+			"exp": now.Add(time.Minute).Unix(), "nbf": now.Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	for _, test := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{AlgRS256, "rsa", rsaKey},
+		{AlgES256, "ec", ecKey},
+		{AlgEdDSA, "ed", edKey},
+		{AlgHS256, "hs", secret},
+	} {
+		c, err := VerifyJWT(context.Background(), signJWT(t, test.alg, test.kid, test.key, claims(nil)), opts)
+		if err != nil || c.Subject() != "user-1" {
+			t.Errorf("%s expected valid token got %v %v", test.alg, c, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"expired":         signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-31 * time.Second).Unix()})),
+		"not yet valid":   signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(31 * time.Second).Unix()})),
+		"string exp":      signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": "tomorrow"})),
+		"string nbf":      signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"nbf": "today"})),
+		"far future nbf":  signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"nbf": 9999999999})),
+		"wrong issuer":    signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.com"})),
+		"wrong audience":  signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"aud": "payments"})),
+		"wrong key":       signJWT(t, AlgES256, "rsa", ecKey, claims(nil)),
+		"alg confusion":   signJWT(t, AlgHS256, "rsa", rsaKey.N.Bytes(), claims(nil)),
+		"none":            b64.EncodeToString([]byte(`{"alg":"none"}`)) + "." + b64.EncodeToString([]byte(`{"sub":"x"}`)) + ".",
+		"bad signature":   signJWT(t, AlgRS256, "rsa", rsaKey, claims(nil))[:50] + "x",
+		"unknown key id":  signJWT(t, AlgRS256, "other", rsaKey, claims(nil)),
+		"malformed token": "abc",
+	}
+
+	for name, token := range invalid {
+		if _, err := VerifyJWT(context.Background(), token, opts); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s expected ErrInvalidCredentials got %v", name, err)
+		}
+	}
+
+	// a common value for tokens that don't expire, past the range of nanosecond timestamps
+	token := signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": 9999999999}))
+	if _, err := VerifyJWT(context.Background(), token, opts); err != nil {
+		t.Errorf("expected token expiring far in the future to be valid got %v", err)
+	}
+
+	// within the leeway
+	token = signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-29 * time.Second).Unix()}))
+	if _, err := VerifyJWT(context.Background(), token, opts); err != nil {
+		t.Errorf("expected token expired within the leeway to be valid got %v", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := func(kid string, k *ecdsa.PrivateKey) map[string]string {
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "alg": AlgES256,
+			"x": b64.EncodeToString(k.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(k.Y.FillBytes(make([]byte, 32)))}
+	}
+
+	var fetches int32
+	var rotated int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		keys := []map[string]string{jwk("k1", oldKey)}
+		if atomic.LoadInt32(&rotated) == 1 {
+			keys = append(keys, jwk("k2", newKey))
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer idp.Close()
+
+	s := New()
+	s.Group("/api").Guard(RequireAuth(JWTAuth(JWTOptions{
+		Keys:  NewJWKSURL(idp.URL, JWKSOptions{MinRefresh: time.Nanosecond}),
+		Realm: "api",
+	}))).Get("/me", func(req *Request) error {
+		return req.Send(req.Principal().ID + " " + req.Claims().String("email") + " " + req.Principal().Scopes[1])
+	})
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	claims := map[string]interface{}{"sub": "u1", "email": "u1@example.com", "scope": "orders:read orders:write",
+		"exp": time.Now().Add(time.Minute).Unix()}
+
+	for i := 0; i < 3; i++ {
+		if w := get(signJWT(t, AlgES256, "k1", oldKey, claims)); w.Body.String() != "u1 u1@example.com orders:write" {
+			t.Fatalf("expected the principal and claims got %d %q", w.Code, w.Body.String())
+		}
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected keys to be cached got %d fetches", n)
+	}
+
+	atomic.StoreInt32(&rotated, 1)
+	if w := get(signJWT(t, AlgES256, "k2", newKey, claims)); w.Code != http.StatusOK {
+		t.Errorf("expected a token signed with the rotated key to be accepted got %d", w.Code)
+	}
+
+	w := get(signJWT(t, AlgES256, "k3", newKey, claims))
+	if w.Code != http.StatusUnauthorized || w.Header().Get(HeaderWWWAuthenticate) != `Bearer realm="api"` {
+		t.Errorf("expected 401 with a challenge for an unknown key got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestJWKSFetching(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64.EncodeToString(secret)},
+	}})
+
+	var fetches int32
+	var failing int32
+	release := make(chan struct{})
+	keys := newJWKS(JWKSOptions{CacheTTL: time.Nanosecond, MinRefresh: time.Hour}, func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		if atomic.LoadInt32(&failing) == 1 {
+			return nil, errors.New("identity provider is down")
+		}
+
+		return jwks, nil
+	})
+
+	// requests arriving while the keys are fetched wait for the same fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.Key(context.Background(), "hs", AlgHS256); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected one shared fetch got %d", n)
+	}
+
+	// the cache has expired but fetches are at least MinRefresh apart so the cached keys are used
+	atomic.StoreInt32(&failing, 1)
+	keys.attempted = time.Time{}
+	for i := 0; i < 3; i++ {
+		if _, err := keys.Key(context.Background(), "hs", AlgHS256); err != nil {
+			t.Errorf("expected cached keys to be used when a fetch fails got %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("expected one fetch after the failure until MinRefresh got %d", n)
+	}
+
+	// a waiting request gives up when its context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	blocked := newJWKS(JWKSOptions{}, func(context.Context) ([]byte, error) {
+		<-stop
+		return nil, errors.New("stopped")
+	})
+	if _, err := blocked.Key(ctx, "hs", AlgHS256); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request's deadline to end the wait got %v", err)
+	}
+}
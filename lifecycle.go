@@ -0,0 +1,353 @@
+package nova
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests have to finish when no timeout is set
+const DefaultShutdownTimeout = 30 * time.Second
+
+// State is the lifecycle state of a Server
+type State int32
+
+// lifecycle states in the order a server moves through them
+const (
+	StateIdle State = iota
+	StateStarting
+	StateRunning
+	StateDraining
+	StateStopped
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+
+	return "unknown"
+}
+
+// ErrServerRunning is returned by Run when the server has already been started
+var ErrServerRunning = errors.New("server has already been started")
+
+// ErrServerNotRunning is returned by Shutdown when Run hasn't been called
+var ErrServerNotRunning = errors.New("server isn't running")
+
+// Hook is a func run when the server starts or shuts down
+type Hook func(ctx context.Context) error
+
+// RunOptions configures how Run listens and shuts down
+type RunOptions struct {
+	// Addr is a TCP address such as :8080 or a unix socket path prefixed with unix: such as unix:/run/app.sock
+	Addr string
+
+	// Listener is used instead of listening on Addr when set
+	Listener net.Listener
+
+	// ShutdownTimeout is how long in-flight requests have to finish once shutdown starts,
+	// defaults to DefaultShutdownTimeout. Connections still open after it are closed.
+	ShutdownTimeout time.Duration
+
+	// ShutdownDelay is how long to keep serving after readiness starts failing so load balancers
+	// stop sending requests before the listener is closed
+	ShutdownDelay time.Duration
+
+	// Signals that start a graceful shutdown, defaults to SIGINT and SIGTERM
+	Signals []os.Signal
+
+	// TLS serves HTTPS with certificates reloaded from disk when set
+	TLS *TLSOptions
+
+	// HTTPServer is used to serve requests when set so its timeouts and limits apply, its Handler is replaced
+	HTTPServer *http.Server
+}
+
+// lifecycle holds the state of a running server
+type lifecycle struct {
+	state int32
+
+	mu            sync.Mutex
+	startHooks    []startHook
+	shutdownHooks []Hook
+	stop          chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+	err           error
+}
+
+// startHook is a start hook with the number of shutdown hooks registered before it,
+// those are run if it fails
+type startHook struct {
+	run   Hook
+	stops int
+}
+
+// State returns the lifecycle state of the server
+func (sn *Server) State() State {
+	return State(atomic.LoadInt32(&sn.lifecycle.state))
+}
+
+// ServerState returns the lifecycle state of the server handling the request,
+// middleware can use it to stop long polling or close keep alive connections while draining
+func (r *Request) ServerState() State {
+	if r.server == nil {
+		return StateIdle
+	}
+
+	return r.server.State()
+}
+
+// OnStart registers a hook that's run by Run before the server accepts connections.
+// Hooks run in the order they're registered and an error stops the server from starting.
+// When a hook fails the shutdown hooks registered before it are run, so register the shutdown hook
+// releasing a resource after the start hook that creates it.
+func (sn *Server) OnStart(h Hook) {
+	sn.lifecycle.mu.Lock()
+	defer sn.lifecycle.mu.Unlock()
+	sn.lifecycle.startHooks = append(sn.lifecycle.startHooks, startHook{run: h, stops: len(sn.lifecycle.shutdownHooks)})
+}
+
+// OnShutdown registers a hook that's run once in-flight requests have drained.
+// Hooks run in the reverse order they're registered so resources are released after the hooks using them.
+func (sn *Server) OnShutdown(h Hook) {
+	sn.lifecycle.mu.Lock()
+	defer sn.lifecycle.mu.Unlock()
+	sn.lifecycle.shutdownHooks = append(sn.lifecycle.shutdownHooks, h)
+}
+
+// Run starts the server and blocks until it has shut down after receiving a signal or a call to Shutdown.
+// On shutdown readiness starts failing, in-flight requests are drained and the shutdown hooks are run.
+func (sn *Server) Run(opts RunOptions) error {
+	l := &sn.lifecycle
+	if !atomic.CompareAndSwapInt32(&l.state, int32(StateIdle), int32(StateStarting)) {
+		return ErrServerRunning
+	}
+
+	l.mu.Lock()
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	startHooks := append([]startHook(nil), l.startHooks...)
+	l.mu.Unlock()
+
+	err := sn.run(opts, startHooks)
+
+	l.mu.Lock()
+	l.err = err
+	l.mu.Unlock()
+
+	atomic.StoreInt32(&l.state, int32(StateStopped))
+	close(l.done)
+	return err
+}
+
+// run starts serving and blocks until the server has stopped
+func (sn *Server) run(opts RunOptions, startHooks []startHook) error {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	for i, h := range startHooks {
+		if err := h.run(context.Background()); err != nil {
+			// release what the hooks before it started
+			sn.runShutdownHooks(opts.ShutdownTimeout, h.stops)
+			return errors.Wrapf(err, "start hook %d failed", i)
+		}
+	}
+
+	var certs *certReloader
+	if opts.TLS != nil {
+		var err error
+		certs, err = newCertReloader(*opts.TLS)
+		if err != nil {
+			sn.runShutdownHooks(opts.ShutdownTimeout, -1)
+			return err
+		}
+	}
+
+	ln, err := listen(opts)
+	if err != nil {
+		sn.runShutdownHooks(opts.ShutdownTimeout, -1)
+		return err
+	}
+
+	srv := opts.HTTPServer
+	if srv == nil {
+		srv = &http.Server{ReadHeaderTimeout: 10 * time.Second}
+	}
+	srv.Handler = sn
+	if certs != nil {
+		srv.TLSConfig = certs.config()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, opts.Signals...)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		if certs != nil {
+			served <- srv.ServeTLS(ln, "", "")
+			return
+		}
+
+		served <- srv.Serve(ln)
+	}()
+
+	atomic.StoreInt32(&sn.lifecycle.state, int32(StateRunning))
+
+	var serveErr error
+	select {
+	case <-signals:
+	case <-sn.lifecycle.stop:
+	case serveErr = <-served:
+	}
+
+	atomic.StoreInt32(&sn.lifecycle.state, int32(StateDraining))
+	if sn.health != nil {
+		sn.health.SetShuttingDown()
+	}
+
+	if serveErr == nil && opts.ShutdownDelay > 0 {
+		select {
+		case <-time.After(opts.ShutdownDelay):
+		case <-signals:
+			// a second signal skips the delay
+		}
+	}
+
+	drainErr := drain(srv, opts.ShutdownTimeout)
+	hookErr := sn.runShutdownHooks(opts.ShutdownTimeout, -1)
+
+	switch {
+	case serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed):
+		return errors.Wrap(serveErr, "serving failed")
+	case drainErr != nil:
+		return drainErr
+	}
+
+	return hookErr
+}
+
+// listen returns the listener for the options
+func listen(opts RunOptions) (net.Listener, error) {
+	if opts.Listener != nil {
+		return opts.Listener, nil
+	}
+
+	if strings.HasPrefix(opts.Addr, "unix:") {
+		path := strings.TrimPrefix(opts.Addr, "unix:")
+
+		// remove a socket left behind by a process that didn't shut down cleanly,
+		// one that still accepts connections belongs to a running server
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			conn, err := net.DialTimeout("unix", path, time.Second)
+			if err == nil {
+				conn.Close()
+				return nil, errors.Errorf("unix socket %s is in use", path)
+			}
+
+			os.Remove(path)
+		}
+
+		ln, err := net.Listen("unix", path)
+		return ln, errors.Wrap(err, "couldn't listen on unix socket")
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	return ln, errors.Wrap(err, "couldn't listen")
+}
+
+// drain waits for in-flight requests to finish, closing the connections left when the timeout is reached
+func drain(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		srv.Close()
+		return errors.Wrap(err, "in-flight requests didn't finish before the shutdown timeout")
+	}
+
+	return nil
+}
+
+// runShutdownHooks runs the first n shutdown hooks, or every hook if n is negative,
+// in reverse order returning the first error
+func (sn *Server) runShutdownHooks(timeout time.Duration, n int) error {
+	sn.lifecycle.mu.Lock()
+	hooks := append([]Hook(nil), sn.lifecycle.shutdownHooks...)
+	sn.lifecycle.mu.Unlock()
+
+	if n >= 0 && n < len(hooks) {
+		hooks = hooks[:n]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var first error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil && first == nil {
+			first = errors.Wrapf(err, "shutdown hook %d failed", i)
+		}
+	}
+
+	return first
+}
+
+// Shutdown gracefully stops a server started with Run and waits for it to stop or ctx to be done.
+// It returns the error Run returned.
+func (sn *Server) Shutdown(ctx context.Context) error {
+	l := &sn.lifecycle
+	l.mu.Lock()
+	stop, done := l.stop, l.done
+	l.mu.Unlock()
+
+	if stop == nil {
+		return ErrServerNotRunning
+	}
+
+	l.stopOnce.Do(func() {
+		close(stop)
+	})
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
@@ -0,0 +1,211 @@
+package nova
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := New()
+	health := s.EnableHealth(HealthOptions{})
+	s.OnStart(func(ctx context.Context) error {
+		order = append(order, "start db")
+		return nil
+	})
+	s.OnStart(func(ctx context.Context) error {
+		order = append(order, "start cache")
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "stop db")
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "stop cache")
+		return nil
+	})
+	s.Get("/slow", func(r *Request) error {
+		close(started)
+		<-release
+		return r.Send(http.StatusText(http.StatusOK))
+	})
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.Run(RunOptions{Listener: ln, ShutdownTimeout: 5 * time.Second})
+	}()
+
+	res := make(chan string, 1)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			res <- err.Error()
+			return
+		}
+		defer r.Body.Close()
+
+		b, _ := io.ReadAll(r.Body)
+		res <- string(b)
+	}()
+
+	<-started
+	if s.State() != StateRunning {
+		t.Errorf("expected running got %s", s.State())
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	// the in-flight request holds the server in the draining state
+	deadline := time.Now().Add(time.Second)
+	for s.State() != StateDraining && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if s.State() != StateDraining || !health.ShuttingDown() {
+		t.Errorf("expected draining with failing readiness got %s", s.State())
+	}
+
+	close(release)
+	if body := <-res; body != http.StatusText(http.StatusOK) {
+		t.Errorf("expected in-flight request to finish got %q", body)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Error(err)
+	}
+
+	if err := <-ran; err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"start db", "start cache", "stop cache", "stop db"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected hooks %v got %v", expected, order)
+	}
+
+	if s.State() != StateStopped {
+		t.Errorf("expected stopped got %s", s.State())
+	}
+
+	if err := s.Run(RunOptions{Listener: ln}); err != ErrServerRunning {
+		t.Errorf("expected ErrServerRunning got %v", err)
+	}
+}
+
+func TestRunUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "nova.sock")
+
+	s := New()
+	s.Get("/state", func(r *Request) error {
+		return r.Send(r.ServerState().String())
+	})
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.Run(RunOptions{Addr: "unix:" + sock})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	var res *http.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		res, err = client.Get("http://nova/state")
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "running" {
+		t.Errorf("expected running state got %q", b)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if err := <-ran; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunStartHookError(t *testing.T) {
+	var order []string
+	s := New()
+	s.OnStart(func(ctx context.Context) error {
+		order = append(order, "start db")
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "stop db")
+		return nil
+	})
+	s.OnStart(func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "stop cache")
+		return nil
+	})
+
+	err := s.Run(RunOptions{Addr: "127.0.0.1:0"})
+	if err == nil || s.State() != StateStopped {
+		t.Errorf("expected start hook error got %v in state %s", err, s.State())
+	}
+
+	if expected := []string{"start db", "stop db"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v got %v", expected, order)
+	}
+}
+
+func TestRunUnixSocketInUse(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "nova.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New().Run(RunOptions{Addr: "unix:" + sock}); err == nil {
+		t.Error("expected a socket that's in use not to be replaced")
+	}
+
+	// a socket nothing answers on is left behind by a server that didn't shut down cleanly
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	stale, err := listen(RunOptions{Addr: "unix:" + sock})
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced got %v", err)
+	}
+	stale.Close()
+}
@@ -0,0 +1,193 @@
+package nova
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clfTime is the time layout used by the Common and Combined Log Formats
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// CommonLogFormat formats entries in the NCSA Common Log Format
+var CommonLogFormat Formatter = FormatterFunc(func(e *AccessLogEntry) []byte {
+	return appendCommon(make([]byte, 0, 128), e, '\n')
+})
+
+// CombinedLogFormat formats entries in the Apache Combined Log Format
+var CombinedLogFormat Formatter = FormatterFunc(func(e *AccessLogEntry) []byte {
+	b := appendCommon(make([]byte, 0, 256), e, ' ')
+	b = append(b, '"')
+	b = append(b, dash(e.Referer)...)
+	b = append(b, "\" \""...)
+	b = append(b, dash(e.UserAgent)...)
+	return append(b, "\"\n"...)
+})
+
+// appendCommon appends the Common Log Format fields followed by end
+func appendCommon(b []byte, e *AccessLogEntry, end byte) []byte {
+	b = append(b, dash(e.RemoteIP)...)
+	b = append(b, " - "...)
+	b = append(b, dash(e.User)...)
+	b = append(b, " ["...)
+	b = e.Time.AppendFormat(b, clfTime)
+	b = append(b, "] \""...)
+	b = append(b, e.Method...)
+	b = append(b, ' ')
+	b = append(b, escapeLog(e.URI)...)
+	b = append(b, ' ')
+	b = append(b, e.Proto...)
+	b = append(b, "\" "...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes == 0 {
+		b = append(b, '-')
+	} else {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	}
+
+	return append(b, end)
+}
+
+// dash returns - for empty values as the log formats require
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return escapeLog(s)
+}
+
+// escapeLog quotes characters that would break a log line
+func escapeLog(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			q := strconv.Quote(s)
+			return q[1 : len(q)-1]
+		}
+	}
+
+	return s
+}
+
+// templateFields are the values available to log templates
+var templateFields = map[string]func(b []byte, e *AccessLogEntry) []byte{
+	"time": func(b []byte, e *AccessLogEntry) []byte {
+		return e.Time.AppendFormat(b, time.RFC3339)
+	},
+	"time_clf": func(b []byte, e *AccessLogEntry) []byte {
+		return e.Time.AppendFormat(b, clfTime)
+	},
+	"time_unix": func(b []byte, e *AccessLogEntry) []byte {
+		return strconv.AppendInt(b, e.Time.Unix(), 10)
+	},
+	"method": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, e.Method...)
+	},
+	"route": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.Route)...)
+	},
+	"path": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, escapeLog(e.Path)...)
+	},
+	"uri": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, escapeLog(e.URI)...)
+	},
+	"proto": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, e.Proto...)
+	},
+	"status": func(b []byte, e *AccessLogEntry) []byte {
+		return strconv.AppendInt(b, int64(e.Status), 10)
+	},
+	"bytes": func(b []byte, e *AccessLogEntry) []byte {
+		return strconv.AppendInt(b, e.Bytes, 10)
+	},
+	"latency": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, e.Latency.String()...)
+	},
+	"latency_ms": func(b []byte, e *AccessLogEntry) []byte {
+		return strconv.AppendFloat(b, float64(e.Latency)/float64(time.Millisecond), 'f', 3, 64)
+	},
+	"latency_us": func(b []byte, e *AccessLogEntry) []byte {
+		return strconv.AppendInt(b, e.Latency.Microseconds(), 10)
+	},
+	"remote_ip": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.RemoteIP)...)
+	},
+	"user_agent": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.UserAgent)...)
+	},
+	"referer": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.Referer)...)
+	},
+	"user": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.User)...)
+	},
+	"request_id": func(b []byte, e *AccessLogEntry) []byte {
+		return append(b, dash(e.RequestID)...)
+	},
+}
+
+// templateFormatter writes entries using a compiled template
+type templateFormatter struct {
+	parts []func(b []byte, e *AccessLogEntry) []byte
+}
+
+// Format implements Formatter
+func (t *templateFormatter) Format(e *AccessLogEntry) []byte {
+	b := make([]byte, 0, 128)
+	for _, p := range t.parts {
+		b = p(b, e)
+	}
+
+	return append(b, '\n')
+}
+
+// NewTemplateFormatter compiles a log template such as "%{method} %{path} %{status} %{latency_ms}".
+// Fields are written as %{name} and %% writes a literal percent sign. The available fields are
+// time, time_clf, time_unix, method, route, path, uri, proto, status, bytes, latency, latency_ms,
+// latency_us, remote_ip, user_agent, referer, user and request_id.
+func NewTemplateFormatter(tmpl string) (Formatter, error) {
+	t := &templateFormatter{}
+	literal := func(s string) {
+		if s != "" {
+			t.parts = append(t.parts, func(b []byte, _ *AccessLogEntry) []byte {
+				return append(b, s...)
+			})
+		}
+	}
+
+	for {
+		i := strings.IndexByte(tmpl, '%')
+		if i < 0 || i == len(tmpl)-1 {
+			literal(tmpl)
+			return t, nil
+		}
+
+		literal(tmpl[:i])
+		switch tmpl[i+1] {
+		case '%':
+			literal("%")
+			tmpl = tmpl[i+2:]
+		case '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed field at offset %d in log template", i)
+			}
+
+			name := tmpl[i+2 : i+end]
+			field, ok := templateFields[name]
+			if !ok {
+				return nil, errors.Errorf("unknown log template field %q", name)
+			}
+
+			t.parts = append(t.parts, field)
+			tmpl = tmpl[i+end+1:]
+		default:
+			literal(tmpl[i : i+2])
+			tmpl = tmpl[i+2:]
+		}
+	}
+}
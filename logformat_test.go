@@ -0,0 +1,99 @@
+package nova
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testEntry() *AccessLogEntry {
+	return &AccessLogEntry{
+		Time:      time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		Method:    "GET",
+		Route:     "/images/:name",
+		Path:      "/images/nova.gif",
+		URI:       "/images/nova.gif?size=2",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     2326,
+		Latency:   1500 * time.Microsecond,
+		RemoteIP:  "127.0.0.1",
+		UserAgent: "Mozilla/4.08",
+		User:      "frank",
+	}
+}
+
+func TestCommonLogFormat(t *testing.T) {
+	expected := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /images/nova.gif?size=2 HTTP/1.1" 200 2326` + "\n"
+	if got := string(CommonLogFormat.Format(testEntry())); got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+}
+
+func TestCombinedLogFormat(t *testing.T) {
+	expected := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /images/nova.gif?size=2 HTTP/1.1" 200 2326 "-" "Mozilla/4.08"` + "\n"
+	if got := string(CombinedLogFormat.Format(testEntry())); got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	f, err := NewTemplateFormatter("%{method} %{route} %{status} %{latency_ms}ms 100%% %{request_id}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "GET /images/:name 200 1.500ms 100% -\n"
+	if got := string(f.Format(testEntry())); got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+	for _, tmpl := range []string{"%{method", "%{nope}"} {
+		if _, err := NewTemplateFormatter(tmpl); err == nil {
+			t.Errorf("expected error for %q", tmpl)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := NewRotatingFile(path, RotateOptions{MaxSize: 10, Daily: true, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	now := time.Date(2020, time.January, 1, 23, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time { return now }
+	rf.day = startOfDay(now)
+
+	// fills the first file then rotates on size
+	rf.Write([]byte("0123456789"))
+	rf.Write([]byte("abc"))
+
+	// rotates on the new day
+	now = now.Add(2 * time.Hour)
+	rf.Write([]byte("def"))
+
+	if _, err := os.Stat(path + ".20200101"); err != nil {
+		t.Errorf("expected daily backup: %s", err)
+	}
+
+	if _, err := os.Stat(path + ".20200101-230000"); err != nil {
+		t.Errorf("expected size backup: %s", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "def" {
+		t.Errorf("expected current file to hold def got %q", data)
+	}
+
+	// a third backup removes the oldest
+	now = now.Add(time.Minute)
+	rf.Rotate()
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 2 {
+		t.Errorf("expected 2 backups got %d", len(matches))
+	}
+}
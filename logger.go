@@ -1,13 +1,18 @@
 // Copyright 2014 Manu Martinez-Almeida.  All rights reserved.
 // Use of this source code is governed by a MIT style
 // license that can be found in the LICENSE file.
-// borrowed from Gin library
+// console colors borrowed from Gin library
 
 package nova
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
@@ -24,34 +29,276 @@ var (
 	reset   = string([]byte{27, 91, 48, 109})
 )
 
-func getDebugMethod(r *Request) func() {
-	// Start timer
-	start := time.Now()
-	return func() {
-		path := r.URL.Path
-
-		// Stop timer
-		end := time.Now()
-		latency := end.Sub(start)
-
-		clientIP := r.RemoteAddr
-		method := r.GetMethod()
-		statusCode := r.ResponseCode
-		var statusColor, methodColor string
-		if isTerminal(os.Stdin.Fd()) {
-			statusColor = colorForStatus(statusCode)
-			methodColor = colorForMethod(method)
+// attribute keys used for access log records
+const (
+	LogKeyMethod    = "method"
+	LogKeyRoute     = "route"
+	LogKeyPath      = "path"
+	LogKeyURI       = "uri"
+	LogKeyProto     = "proto"
+	LogKeyStatus    = "status"
+	LogKeyBytes     = "bytes"
+	LogKeyLatency   = "latency"
+	LogKeyRemoteIP  = "remote_ip"
+	LogKeyUserAgent = "user_agent"
+	LogKeyReferer   = "referer"
+	LogKeyUser      = "user"
+	LogKeyRequestID = "request_id"
+)
+
+// AccessLogMessage is the message of every access log record
+const AccessLogMessage = "request"
+
+// AccessLogEntry holds the details of a completed request
+type AccessLogEntry struct {
+	Time      time.Time
+	Method    string
+	Route     string
+	Path      string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	RemoteIP  string
+	UserAgent string
+	Referer   string
+	User      string
+	RequestID string
+}
+
+// attrs returns the entry as slog attributes
+func (e *AccessLogEntry) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String(LogKeyMethod, e.Method),
+		slog.String(LogKeyRoute, e.Route),
+		slog.String(LogKeyPath, e.Path),
+		slog.String(LogKeyURI, e.URI),
+		slog.String(LogKeyProto, e.Proto),
+		slog.Int(LogKeyStatus, e.Status),
+		slog.Int64(LogKeyBytes, e.Bytes),
+		slog.Duration(LogKeyLatency, e.Latency),
+		slog.String(LogKeyRemoteIP, e.RemoteIP),
+		slog.String(LogKeyUserAgent, e.UserAgent),
+		slog.String(LogKeyReferer, e.Referer),
+	}
+
+	if e.User != "" {
+		attrs = append(attrs, slog.String(LogKeyUser, e.User))
+	}
+
+	if e.RequestID != "" {
+		attrs = append(attrs, slog.String(LogKeyRequestID, e.RequestID))
+	}
+
+	return attrs
+}
+
+// setAttr sets the entry field matching the attribute's key
+func (e *AccessLogEntry) setAttr(a slog.Attr) {
+	v := a.Value.Resolve()
+	switch a.Key {
+	case LogKeyMethod:
+		e.Method = v.String()
+	case LogKeyRoute:
+		e.Route = v.String()
+	case LogKeyPath:
+		e.Path = v.String()
+	case LogKeyURI:
+		e.URI = v.String()
+	case LogKeyProto:
+		e.Proto = v.String()
+	case LogKeyStatus:
+		e.Status = int(v.Int64())
+	case LogKeyBytes:
+		e.Bytes = v.Int64()
+	case LogKeyLatency:
+		e.Latency = v.Duration()
+	case LogKeyRemoteIP:
+		e.RemoteIP = v.String()
+	case LogKeyUserAgent:
+		e.UserAgent = v.String()
+	case LogKeyReferer:
+		e.Referer = v.String()
+	case LogKeyUser:
+		e.User = v.String()
+	case LogKeyRequestID:
+		e.RequestID = v.String()
+	}
+}
+
+// AccessLog sets the handler that access log records are written to, nil disables access logging.
+// Any slog.Handler can be used, NewConsoleHandler keeps nova's colored console output.
+func (sn *Server) AccessLog(h slog.Handler) {
+	if h == nil {
+		sn.accessLog = nil
+		return
+	}
+
+	sn.accessLog = slog.New(h)
+}
+
+// logRequest writes the access log record for a completed request
+func (sn *Server) logRequest(r *Request, start time.Time) {
+	end := time.Now()
+	e := AccessLogEntry{
+		Time:      end,
+		Method:    r.GetMethod(),
+		Route:     r.RoutePattern(),
+		Path:      r.URL.Path,
+		URI:       r.RequestURI,
+		Proto:     r.Proto,
+		Status:    r.ResponseCode,
+		Bytes:     r.BytesWritten(),
+		Latency:   end.Sub(start),
+		RemoteIP:  r.ClientIP(),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+		RequestID: r.RequestID(),
+	}
+
+	// only authenticated users are logged so unchecked credentials can't be written to the log
+	if p := r.Principal(); p != nil {
+		e.User = p.ID
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case e.Status >= 500:
+		level = slog.LevelError
+	case e.Status >= 400:
+		level = slog.LevelWarn
+	}
+
+	attrs := e.attrs()
+	if sn.logPolicy != nil {
+		log, slow := sn.logPolicy.shouldLog(&e)
+		if !log {
+			return
+		}
+
+		if slow {
+			attrs = append(attrs, sn.logPolicy.slowAttrs(r)...)
+			if level < slog.LevelWarn {
+				level = slog.LevelWarn
+			}
 		}
+	}
+
+	sn.accessLog.LogAttrs(r.Context(), level, AccessLogMessage, attrs...)
+}
+
+// remoteIP strips the port from a remote address
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// Formatter turns an access log entry into a line of output
+type Formatter interface {
+	Format(e *AccessLogEntry) []byte
+}
 
-		fmt.Printf("[Nova] %v |%s %3d %s| %13v | %s |%s  %s %-7s %s\n",
-			end.Format("2006/01/02 - 15:04:05"),
-			statusColor, statusCode, reset,
-			latency,
-			clientIP,
-			methodColor, reset, method,
-			path,
-		)
+// FormatterFunc adapts a function to the Formatter interface
+type FormatterFunc func(e *AccessLogEntry) []byte
+
+// Format calls f
+func (f FormatterFunc) Format(e *AccessLogEntry) []byte {
+	return f(e)
+}
+
+// formatHandler is an slog.Handler that writes access log records to w using a Formatter
+type formatHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	f     Formatter
+	attrs []slog.Attr
+}
+
+// NewFormatHandler returns an slog.Handler that writes each access log record to w using f.
+// Records that aren't access log records are ignored.
+func NewFormatHandler(w io.Writer, f Formatter) slog.Handler {
+	return &formatHandler{mu: &sync.Mutex{}, w: w, f: f}
+}
+
+// Enabled implements slog.Handler
+func (h *formatHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+// Handle implements slog.Handler
+func (h *formatHandler) Handle(_ context.Context, r slog.Record) error {
+	if r.Message != AccessLogMessage {
+		return nil
+	}
+
+	e := AccessLogEntry{Time: r.Time}
+	for _, a := range h.attrs {
+		e.setAttr(a)
 	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		e.setAttr(a)
+		return true
+	})
+
+	line := h.f.Format(&e)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(line)
+	return err
+}
+
+// WithAttrs implements slog.Handler
+func (h *formatHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	n := *h
+	n.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &n
+}
+
+// WithGroup implements slog.Handler, groups have no meaning for a single line format
+func (h *formatHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// ConsoleFormatter writes the [Nova] console line, optionally colored by status and method
+type ConsoleFormatter struct {
+	Color bool
+}
+
+// Format implements Formatter
+func (c ConsoleFormatter) Format(e *AccessLogEntry) []byte {
+	var statusColor, methodColor, resetColor string
+	if c.Color {
+		statusColor = colorForStatus(e.Status)
+		methodColor = colorForMethod(e.Method)
+		resetColor = reset
+	}
+
+	return []byte(fmt.Sprintf("[Nova] %v |%s %3d %s| %13v | %s |%s  %s %-7s %s\n",
+		e.Time.Format("2006/01/02 - 15:04:05"),
+		statusColor, e.Status, resetColor,
+		e.Latency,
+		e.RemoteIP,
+		methodColor, resetColor, e.Method,
+		e.Path,
+	))
+}
+
+// NewConsoleHandler returns a handler writing the [Nova] console format to w,
+// colored if w is a terminal
+func NewConsoleHandler(w io.Writer) slog.Handler {
+	color := false
+	if f, ok := w.(*os.File); ok {
+		color = isTerminal(f.Fd())
+	}
+
+	return NewFormatHandler(w, ConsoleFormatter{Color: color})
 }
 
 // IsTerminal returns true if the given file descriptor is a terminal.
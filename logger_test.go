@@ -0,0 +1,105 @@
+package nova
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(slog.NewJSONHandler(&buf, nil))
+	s.Get("/hello/:name", func(r *Request) error {
+		return r.Write(http.StatusCreated, "hello")
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/hello/world", nil)
+	req.Header.Set("User-Agent", "nova-test")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		LogKeyMethod:    "GET",
+		LogKeyRoute:     "/hello/:name",
+		LogKeyPath:      "/hello/world",
+		LogKeyStatus:    float64(http.StatusCreated),
+		LogKeyBytes:     float64(5),
+		LogKeyRemoteIP:  "127.0.0.1",
+		LogKeyUserAgent: "nova-test",
+	}
+
+	for key, val := range expected {
+		if entry[key] != val {
+			t.Errorf("%s expected %v got %v", key, val, entry[key])
+		}
+	}
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(NewConsoleHandler(&buf))
+	s.Get("/test", func(r *Request) error {
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "[Nova] ") || !strings.Contains(line, "| 404 |") || !strings.HasSuffix(line, "GET     /missing\n") {
+		t.Errorf("unexpected console line %q", line)
+	}
+}
+
+func TestServer_AccessLogUser(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(slog.NewJSONHandler(&buf, nil))
+	s.Get("/me", func(r *Request) error {
+		return nil
+	}, WithGuard(RequireAuth(BasicAuth("nova", BasicAuthUsers(map[string]string{"ann": "secret"})))))
+
+	for _, password := range []string{"wrong", "secret"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.SetBasicAuth("ann", password)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		user, ok := entry[LogKeyUser]
+		if password == "wrong" && ok {
+			t.Errorf("expected a user that failed to authenticate not to be logged got %v", user)
+		}
+
+		if password == "secret" && user != "ann" {
+			t.Errorf("expected the authenticated user to be logged got %v", user)
+		}
+	}
+}
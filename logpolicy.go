@@ -0,0 +1,139 @@
+package nova
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// attribute keys added to slow request records
+const (
+	LogKeySlow    = "slow"
+	LogKeyHeaders = "headers"
+	LogKeyBody    = "body"
+)
+
+// DefaultRedactHeaders are the request headers whose values are never captured for slow requests
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// LogPolicy decides which requests are written to the access log
+type LogPolicy struct {
+	// Exclude lists route patterns or paths that aren't logged such as /healthz.
+	// Excluded requests are still logged if they're slow, or if they error and AlwaysLogErrors is set.
+	Exclude []string
+
+	// SampleRate is the fraction of requests logged between 0 and 1. 0 logs every request,
+	// a negative rate logs none so only errors and slow requests are written.
+	SampleRate float64
+
+	// AlwaysLogErrors logs every 5xx response regardless of sampling
+	AlwaysLogErrors bool
+
+	// SlowThreshold logs every request that takes longer than it regardless of sampling
+	// along with its headers and the start of its body, 0 disables slow request capture
+	SlowThreshold time.Duration
+
+	// SlowBodySize is how many bytes of the request body are captured for slow requests
+	SlowBodySize int
+
+	// RedactHeaders are headers whose values are replaced for slow requests, defaults to DefaultRedactHeaders
+	RedactHeaders []string
+}
+
+// LogPolicy sets the policy deciding which requests are written to the access log
+func (sn *Server) LogPolicy(p LogPolicy) {
+	if len(p.RedactHeaders) == 0 {
+		p.RedactHeaders = DefaultRedactHeaders
+	}
+
+	sn.logPolicy = &p
+}
+
+// shouldLog reports whether the entry is written and whether it's a slow request
+func (p *LogPolicy) shouldLog(e *AccessLogEntry) (log bool, slow bool) {
+	if p.SlowThreshold > 0 && e.Latency >= p.SlowThreshold {
+		return true, true
+	}
+
+	if p.AlwaysLogErrors && e.Status >= 500 {
+		return true, false
+	}
+
+	for _, ex := range p.Exclude {
+		if ex == e.Route || ex == e.Path {
+			return false, false
+		}
+	}
+
+	switch {
+	case p.SampleRate == 0 || p.SampleRate >= 1:
+		return true, false
+	case p.SampleRate < 0:
+		return false, false
+	}
+
+	return rand.Float64() < p.SampleRate, false
+}
+
+// slowAttrs captures the headers and body snapshot of a slow request
+func (p *LogPolicy) slowAttrs(r *Request) []slog.Attr {
+	headers := r.Request.Header.Clone()
+	for _, h := range p.RedactHeaders {
+		if headers.Get(h) != "" {
+			headers.Set(h, "[redacted]")
+		}
+	}
+
+	headerAttrs := make([]any, 0, len(headers))
+	for key, values := range headers {
+		if len(values) == 1 {
+			headerAttrs = append(headerAttrs, slog.String(key, values[0]))
+		} else {
+			headerAttrs = append(headerAttrs, slog.Any(key, values))
+		}
+	}
+
+	attrs := []slog.Attr{
+		slog.Bool(LogKeySlow, true),
+		slog.Group(LogKeyHeaders, headerAttrs...),
+	}
+
+	if r.bodySnapshot != nil {
+		attrs = append(attrs, slog.String(LogKeyBody, string(r.bodySnapshot.buf)))
+	}
+
+	return attrs
+}
+
+// snapshotBody keeps a copy of the first bytes read from a request body
+type snapshotBody struct {
+	io.ReadCloser
+	buf []byte
+	max int
+}
+
+// captureBody records up to n bytes of the body as the handler reads it
+func (r *Request) captureBody(n int) {
+	if n <= 0 || r.Request.Body == nil || r.Request.Body == http.NoBody {
+		return
+	}
+
+	r.bodySnapshot = &snapshotBody{ReadCloser: r.Request.Body, max: n}
+	r.Request.Body = r.bodySnapshot
+}
+
+// Read reads from the body keeping a copy until the snapshot is full
+func (b *snapshotBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.max - len(b.buf); room > 0 && n > 0 {
+		if n < room {
+			room = n
+		}
+
+		b.buf = append(b.buf, p[:room]...)
+	}
+
+	return n, err
+}
@@ -0,0 +1,139 @@
+package nova
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_LogPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(slog.NewJSONHandler(&buf, nil))
+	s.LogPolicy(LogPolicy{
+		Exclude:         []string{"/healthz"},
+		SampleRate:      -1,
+		AlwaysLogErrors: true,
+	})
+
+	s.Get("/healthz", func(r *Request) error {
+		return nil
+	})
+	s.Get("/ok", func(r *Request) error {
+		return nil
+	})
+	s.Get("/fail", func(r *Request) error {
+		r.StatusCode(http.StatusInternalServerError)
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, endpoint := range []string{"/healthz", "/ok", "/fail"} {
+		res, err := http.Get(ts.URL + endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"path":"/fail"`) {
+		t.Errorf("expected only /fail to be logged got %v", lines)
+	}
+}
+
+func TestServer_LogPolicySlow(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(slog.NewJSONHandler(&buf, nil))
+	s.LogPolicy(LogPolicy{
+		SampleRate:    -1,
+		SlowThreshold: 10 * time.Millisecond,
+		SlowBodySize:  5,
+	})
+
+	s.Post("/slow", func(r *Request) error {
+		var body struct{}
+		r.ReadJSON(&body)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/slow", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	var entry struct {
+		Level   string
+		Slow    bool
+		Body    string
+		Headers map[string]interface{}
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.Slow || entry.Level != "WARN" || entry.Body != `{"hel` {
+		t.Errorf("unexpected slow entry %+v", entry)
+	}
+
+	if entry.Headers["Authorization"] != "[redacted]" {
+		t.Errorf("authorization header wasn't redacted got %v", entry.Headers["Authorization"])
+	}
+}
+
+func TestServer_LogPolicySlowDecompressed(t *testing.T) {
+	var buf bytes.Buffer
+	s := New()
+	s.AccessLog(slog.NewJSONHandler(&buf, nil))
+	s.LogPolicy(LogPolicy{
+		SampleRate:    -1,
+		SlowThreshold: 10 * time.Millisecond,
+		SlowBodySize:  5,
+	})
+	s.Use(Decompress(DecompressOptions{}))
+
+	s.Post("/slow", func(r *Request) error {
+		var body struct{}
+		r.ReadJSON(&body)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"hello": "world"}`))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/slow", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Body string
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Body != `{"hel` {
+		t.Errorf("expected the decompressed body to be logged got %q", entry.Body)
+	}
+}
@@ -0,0 +1,299 @@
+package nova
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDurationBuckets are the latency histogram buckets in seconds
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the response size histogram buckets in bytes
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// unmatchedRoute is the route label for requests that didn't match a route
+const unmatchedRoute = "unmatched"
+
+// MetricsOptions configures the metrics recorded for a Server
+type MetricsOptions struct {
+	// Namespace prefixes every metric name, defaults to nova
+	Namespace string
+
+	// DurationBuckets are the latency histogram buckets in seconds, defaults to DefaultDurationBuckets
+	DurationBuckets []float64
+
+	// SizeBuckets are the response size histogram buckets in bytes, defaults to DefaultSizeBuckets
+	SizeBuckets []float64
+}
+
+// Metrics records request counts, latencies and response sizes labeled by method, route pattern
+// and status class and exposes them in the Prometheus text format
+type Metrics struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	inFlight int64
+	series   sync.Map
+}
+
+// seriesKey identifies the labels of a series
+type seriesKey struct {
+	method string
+	route  string
+	status string
+}
+
+// series holds the metrics for a single set of labels
+type series struct {
+	count    uint64
+	duration *histogram
+	size     *histogram
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	upper  []float64
+	counts []uint64
+	sum    uint64
+	count  uint64
+}
+
+// EnableMetrics records metrics for every request and returns them so they can be exposed,
+// typically with s.Get("/metrics", metrics.Handle)
+func (sn *Server) EnableMetrics(opts MetricsOptions) *Metrics {
+	m := NewMetrics(opts)
+	sn.metrics = m
+	return m
+}
+
+// NewMetrics returns an empty set of metrics
+func NewMetrics(opts MetricsOptions) *Metrics {
+	m := &Metrics{
+		namespace:       opts.Namespace,
+		durationBuckets: opts.DurationBuckets,
+		sizeBuckets:     opts.SizeBuckets,
+	}
+
+	if m.namespace == "" {
+		m.namespace = "nova"
+	}
+
+	if len(m.durationBuckets) == 0 {
+		m.durationBuckets = DefaultDurationBuckets
+	}
+
+	if len(m.sizeBuckets) == 0 {
+		m.sizeBuckets = DefaultSizeBuckets
+	}
+
+	return m
+}
+
+// start marks a request as in flight and returns the func recording it once it's finished
+func (m *Metrics) start(r *Request) func() {
+	atomic.AddInt64(&m.inFlight, 1)
+	start := time.Now()
+
+	return func() {
+		atomic.AddInt64(&m.inFlight, -1)
+		m.Observe(r.GetMethod(), r.RoutePattern(), r.ResponseCode, time.Since(start), r.BytesWritten())
+	}
+}
+
+// Observe records a completed request
+func (m *Metrics) Observe(method, route string, status int, latency time.Duration, size int64) {
+	key := seriesKey{
+		method: metricMethod(method),
+		route:  route,
+		status: statusClass(status),
+	}
+
+	if key.route == "" {
+		key.route = unmatchedRoute
+	}
+
+	v, ok := m.series.Load(key)
+	if !ok {
+		v, _ = m.series.LoadOrStore(key, &series{
+			duration: newHistogram(m.durationBuckets),
+			size:     newHistogram(m.sizeBuckets),
+		})
+	}
+
+	s := v.(*series)
+	atomic.AddUint64(&s.count, 1)
+	s.duration.observe(latency.Seconds())
+	s.size.observe(float64(size))
+}
+
+// metricMethod bounds the method label to the standard methods
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+// statusClass returns the class of a status code such as 2xx
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(code/100) + "xx"
+}
+
+func newHistogram(upper []float64) *histogram {
+	return &histogram{
+		upper:  upper,
+		counts: make([]uint64, len(upper)),
+	}
+}
+
+// observe adds v to every bucket it falls under. The count, which is the +Inf bucket, and then the
+// largest buckets are incremented first so a concurrent scrape reading the buckets in order never sees
+// a bucket larger than the ones after it.
+func (h *histogram) observe(v float64) {
+	atomic.AddUint64(&h.count, 1)
+	for i := len(h.upper) - 1; i >= 0; i-- {
+		if v <= h.upper[i] {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+
+	// add to the sum stored as float bits
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sum, old, sum) {
+			break
+		}
+	}
+}
+
+// Handle writes the metrics in the Prometheus text exposition format
+func (m *Metrics) Handle(r *Request) error {
+	m.ServeHTTP(r.ResponseWriter, r.Request)
+	return nil
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+// write writes the metrics in the Prometheus text exposition format
+func (m *Metrics) write(w *bufio.Writer) {
+	var keys []seriesKey
+	m.series.Range(func(k, _ interface{}) bool {
+		keys = append(keys, k.(seriesKey))
+		return true
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+
+		if a.method != b.method {
+			return a.method < b.method
+		}
+
+		return a.status < b.status
+	})
+
+	name := m.namespace + "_http_requests_total"
+	writeMeta(w, name, "counter", "Total number of HTTP requests handled.")
+	for _, k := range keys {
+		s := m.load(k)
+		writeSample(w, name, k.labels(), "", float64(atomic.LoadUint64(&s.count)))
+	}
+
+	name = m.namespace + "_http_requests_in_flight"
+	writeMeta(w, name, "gauge", "Number of HTTP requests currently being handled.")
+	writeSample(w, name, "", "", float64(atomic.LoadInt64(&m.inFlight)))
+
+	name = m.namespace + "_http_request_duration_seconds"
+	writeMeta(w, name, "histogram", "HTTP request latency in seconds.")
+	for _, k := range keys {
+		m.load(k).duration.write(w, name, k.labels())
+	}
+
+	name = m.namespace + "_http_response_size_bytes"
+	writeMeta(w, name, "histogram", "HTTP response body size in bytes.")
+	for _, k := range keys {
+		m.load(k).size.write(w, name, k.labels())
+	}
+}
+
+func (m *Metrics) load(k seriesKey) *series {
+	v, _ := m.series.Load(k)
+	return v.(*series)
+}
+
+// labels formats the series labels
+func (k seriesKey) labels() string {
+	return `method="` + escapeLabel(k.method) + `",route="` + escapeLabel(k.route) + `",status="` + k.status + `"`
+}
+
+// write writes the buckets, sum and count of the histogram
+func (h *histogram) write(w *bufio.Writer, name, labels string) {
+	for i, upper := range h.upper {
+		writeSample(w, name+"_bucket", labels, `le="`+formatFloat(upper)+`"`, float64(atomic.LoadUint64(&h.counts[i])))
+	}
+
+	count := float64(atomic.LoadUint64(&h.count))
+	writeSample(w, name+"_bucket", labels, `le="+Inf"`, count)
+	writeSample(w, name+"_sum", labels, "", math.Float64frombits(atomic.LoadUint64(&h.sum)))
+	writeSample(w, name+"_count", labels, "", count)
+}
+
+func writeMeta(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name, labels, extra string, v float64) {
+	w.WriteString(name)
+	if labels != "" || extra != "" {
+		w.WriteByte('{')
+		w.WriteString(labels)
+		if labels != "" && extra != "" {
+			w.WriteByte(',')
+		}
+		w.WriteString(extra)
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(v string) string {
+	if !strings.ContainsAny(v, "\\\"\n") {
+		return v
+	}
+
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,97 @@
+package nova
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServer_EnableMetrics(t *testing.T) {
+	s := New()
+	m := s.EnableMetrics(MetricsOptions{})
+	s.Get("/metrics", m.Handle)
+	s.Get("/users/:id", func(r *Request) error {
+		return r.Send("user")
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, endpoint := range []string{"/users/1", "/users/2", "/missing"} {
+		res, err := http.Get(ts.URL + endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	body := string(data)
+
+	expected := []string{
+		"# TYPE nova_http_requests_total counter",
+		`nova_http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`,
+		`nova_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		"nova_http_requests_in_flight 1",
+		`nova_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`,
+		`nova_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="100"} 2`,
+		`nova_http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 8`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+}
+
+func TestHistogram_ConcurrentScrape(t *testing.T) {
+	h := newHistogram([]float64{1, 10, 100})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50000; i++ {
+				h.observe(0)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// read the buckets in the order they're written
+		var last uint64
+		for i := range h.upper {
+			c := atomic.LoadUint64(&h.counts[i])
+			if c < last {
+				t.Fatalf("bucket %v has %d less than the bucket before it %d", h.upper[i], c, last)
+			}
+			last = c
+		}
+
+		if inf := atomic.LoadUint64(&h.count); inf < last {
+			t.Fatalf("+Inf bucket %d is less than the largest bucket %d", inf, last)
+		}
+	}
+}
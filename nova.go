@@ -3,22 +3,64 @@
 package nova
 
 import (
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Server represents the router and all associated data
 type Server struct {
-	// radix tree for looking up routes
-	paths      map[string]*Node
+	// radix tree for looking up routes, holds a map[string]*Node that's replaced rather than modified
+	// so lookups don't need a lock, routesMu is held while building the replacement
+	paths      atomic.Value
+	routesMu   sync.Mutex
 	middleWare []Middleware
 
 	// error callback func
 	errorFunc ErrorFunc
 
-	// debug defines logging for requests
-	debug bool
+	// access log records are written here when set
+	accessLog *slog.Logger
+	logPolicy *LogPolicy
+
+	// assigns request ids when set
+	requestID *RequestIDOptions
+
+	// records request metrics when set
+	metrics *Metrics
+
+	// creates a span for each request when set
+	tracer Tracer
+
+	// health checks exposed by the server
+	health *Health
+
+	// sends the Server-Timing header, timingUsed is set if any group could send it
+	serverTiming bool
+	timingUsed   bool
+
+	// proxies whose forwarding headers are trusted
+	trustedProxies []*net.IPNet
+
+	// CORS policy for every route, corsUsed is set if any group has a policy
+	cors     *corsPolicy
+	corsUsed bool
+
+	// limits applied to request bodies when not set on the route
+	bodyLimit       int64
+	bodyReadTimeout time.Duration
+
+	// state and hooks used by Run and Shutdown
+	lifecycle lifecycle
 }
 
 // RequestFunc is the callback used in all handler func
@@ -41,17 +83,16 @@ type Middleware struct {
 // New returns new supernova router
 func New() *Server {
 	return &Server{
-		paths: map[string]*Node{},
-		// set a default empty error func so we don't have to
+		// set a default error func so we don't have to
 		// check if it's set to nil
-		errorFunc: func(req *Request, err error) {},
+		errorFunc: defaultErrorFunc,
 	}
 }
 
-// EnableDebug toggles output for incoming requests
+// EnableDebug logs incoming requests to stdout in the console format if no access log handler is set
 func (sn *Server) EnableDebug(debug bool) {
-	if debug {
-		sn.debug = true
+	if debug && sn.accessLog == nil {
+		sn.AccessLog(NewConsoleHandler(os.Stdout))
 	}
 }
 
@@ -63,21 +104,131 @@ func (sn *Server) ErrorFunc(f ErrorFunc) {
 	}
 }
 
+// BodyLimit sets the maximum number of bytes that can be read from a request body,
+// routes and groups can override it. Reading past the limit returns a PayloadTooLargeError.
+func (sn *Server) BodyLimit(n int64) {
+	sn.bodyLimit = n
+}
+
+// BodyReadTimeout sets how long handlers have to read the request body,
+// routes and groups can override it
+func (sn *Server) BodyReadTimeout(d time.Duration) {
+	sn.bodyReadTimeout = d
+}
+
+// defaultErrorFunc responds with the status code for errors returned by nova's body readers
+// and upload helpers if the handler hasn't already responded
+func defaultErrorFunc(req *Request, err error) {
+	if req.HeaderWritten() {
+		return
+	}
+
+	// the client has gone so there's no one to respond to
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		req.Error(http.StatusServiceUnavailable, "request timed out", nil)
+		return
+	}
+
+	var tooLarge *PayloadTooLargeError
+	if errors.As(err, &tooLarge) {
+		req.Error(http.StatusRequestEntityTooLarge, "request body too large", nil)
+		return
+	}
+
+	var unauthorized *UnauthorizedError
+	if errors.As(err, &unauthorized) {
+		req.Error(http.StatusUnauthorized, unauthorized.Reason, nil)
+		return
+	}
+
+	var authErr *AuthenticatorError
+	if errors.As(err, &authErr) {
+		req.Error(http.StatusInternalServerError, "couldn't authenticate request", nil)
+		return
+	}
+
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		req.Error(http.StatusForbidden, forbidden.Reason, nil)
+		return
+	}
+
+	if errors.Is(err, ErrTooManyFiles) {
+		req.Error(http.StatusRequestEntityTooLarge, err.Error(), nil)
+		return
+	}
+
+	if errors.Is(err, ErrUnsupportedFileType) {
+		req.Error(http.StatusUnsupportedMediaType, err.Error(), nil)
+		return
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		req.Error(http.StatusRequestTimeout, "timed out reading request body", nil)
+	}
+}
+
 // handler is the main entry point into the router
 func (sn *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	request := NewRequest(w, r)
-	if sn.debug {
-		defer getDebugMethod(request)
+	request.server = sn
+	if sn.requestID != nil {
+		sn.requestID.assignRequestID(request)
+	}
+
+	if sn.accessLog != nil {
+		defer sn.logRequest(request, time.Now())
+	}
+
+	if sn.metrics != nil {
+		defer sn.metrics.start(request)()
+	}
+
+	if sn.tracer != nil {
+		defer sn.startServerSpan(request)()
+	}
+	defer request.finish()
+
+	if sn.bodyLimit > 0 {
+		request.limitBody(sn.bodyLimit)
+	}
+
+	if sn.timingUsed {
+		sn.startTiming(request)
+	}
+
+	// preflights are answered before middleware as browsers don't send credentials with them
+	if sn.corsUsed {
+		if isPreflight(r) && sn.handlePreflight(request) {
+			return
+		}
+
+		if sn.cors != nil {
+			sn.cors.apply(request)
+		}
 	}
 
 	// Run Middleware
+	phase := time.Now()
 	finished := sn.runMiddleware(request)
+	if request.timing != nil {
+		phase = request.timing.mark("middleware", phase)
+	}
+
 	if !finished {
 		return
 	}
 
 	// search the tree for the route that matches the path and method
 	route := sn.climbTree(request.GetMethod(), cleanPath(request.URL.Path))
+	if request.timing != nil {
+		request.timing.handler = request.timing.mark("router", phase)
+	}
 
 	// if no route is found return a 404
 	if route == nil {
@@ -85,41 +236,63 @@ func (sn *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	request.route = route
+	opts := route.options()
+	if opts.cors != nil && opts.cors != sn.cors {
+		opts.cors.apply(request)
+	}
+
+	if opts.bodyLimit != 0 {
+		request.limitBody(opts.bodyLimit)
+	}
+
+	timeout := sn.bodyReadTimeout
+	if opts.bodyReadTimeout != 0 {
+		timeout = opts.bodyReadTimeout
+	}
+	request.setBodyReadDeadline(timeout)
+
+	// captured once middleware such as Decompress has replaced the body so the decoded body is logged
+	if sn.accessLog != nil && sn.logPolicy != nil && sn.logPolicy.SlowThreshold > 0 {
+		request.captureBody(sn.logPolicy.SlowBodySize)
+	}
+
 	// execute the found route and if there is an error returned execute the error func
 	err := route.call(request)
 	if err != nil {
+		request.Span().SetError(err)
 		sn.errorFunc(request, err)
 	}
 }
 
 // All adds route for all http methods
-func (sn *Server) All(route string, routeFunc RequestFunc) {
-	sn.addRoute("", buildRoute(route, routeFunc))
+func (sn *Server) All(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute("", buildRoute(route, routeFunc), opts)
 }
 
 // Get adds only GET method to route
-func (sn *Server) Get(route string, routeFunc RequestFunc) {
-	sn.addRoute(http.MethodGet, buildRoute(route, routeFunc))
+func (sn *Server) Get(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute(http.MethodGet, buildRoute(route, routeFunc), opts)
 }
 
 // Post adds only POST method to route
-func (sn *Server) Post(route string, routeFunc RequestFunc) {
-	sn.addRoute(http.MethodPost, buildRoute(route, routeFunc))
+func (sn *Server) Post(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute(http.MethodPost, buildRoute(route, routeFunc), opts)
 }
 
 // Put adds only PUT method to route
-func (sn *Server) Put(route string, routeFunc RequestFunc) {
-	sn.addRoute(http.MethodPut, buildRoute(route, routeFunc))
+func (sn *Server) Put(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute(http.MethodPut, buildRoute(route, routeFunc), opts)
 }
 
 // Delete adds only DELETE method to route
-func (sn *Server) Delete(route string, routeFunc RequestFunc) {
-	sn.addRoute(http.MethodDelete, buildRoute(route, routeFunc))
+func (sn *Server) Delete(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute(http.MethodDelete, buildRoute(route, routeFunc), opts)
 }
 
 // Restricted adds route that is restricted by method
-func (sn *Server) Restricted(method, route string, routeFunc RequestFunc) {
-	sn.addRoute(method, buildRoute(route, routeFunc))
+func (sn *Server) Restricted(method, route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return sn.addRoute(method, buildRoute(route, routeFunc), opts)
 }
 
 // Group creates a new sub router that appends the path prefix
@@ -130,42 +303,122 @@ func (sn *Server) Group(path string) *RouteGroup {
 	}
 }
 
-// addRoute takes route and method and adds it to route tree
-func (sn *Server) addRoute(method string, route *Route) {
-	// if a base node isn't set for a method set it
-	if sn.paths[method] == nil {
-		sn.paths[method] = newNode()
+// addRoute applies the options to the route then adds it to the route tree, replacing the route if it's already registered.
+// The nodes along the path are copied and the new tree swapped in so lookups never see a partial update.
+func (sn *Server) addRoute(method string, route *Route, opts []RouteOption) *Route {
+	for _, opt := range opts {
+		opt(route)
 	}
 
-	// split the path parts and start building out tree from method node
-	parts := strings.Split(route.route, "/")
-	currentNode := sn.paths[method]
-	for index, val := range parts {
-		childKey := val
-		if len(val) > 1 {
-			// if first character is a colon this part of path is a parameter set to an empty key
-			if val[0] == ':' {
-				childKey = ""
-			}
-		}
+	sn.routesMu.Lock()
+	defer sn.routesMu.Unlock()
+	return sn.insertRoute(method, route)
+}
+
+// insertRoute adds the route to a copy of the tree and swaps it in, routesMu must be held
+func (sn *Server) insertRoute(method string, route *Route) *Route {
+	paths := sn.copyPaths()
+	currentNode := paths[method].clone()
+	paths[method] = currentNode
+
+	keys := routeKeys(route.route)
+	for _, key := range keys {
+		node := currentNode.children[key].clone()
+		currentNode.children[key] = node
+		currentNode = node
+	}
+
+	currentNode.route = route
+	sn.paths.Store(paths)
+	return route
+}
+
+// Remove removes the route registered for method and path, an empty method removes a route added with All.
+// It's safe to call while serving and reports whether a route was removed.
+func (sn *Server) Remove(method, route string) bool {
+	sn.routesMu.Lock()
+	defer sn.routesMu.Unlock()
+
+	paths := sn.copyPaths()
+	root, ok := paths[method]
+	if !ok {
+		return false
+	}
+
+	root, removed := root.remove(routeKeys(path.Clean(route)))
+	if !removed {
+		return false
+	}
+
+	paths[method] = root
+	sn.paths.Store(paths)
+	return true
+}
+
+// Replace swaps the handler of a registered route keeping its options, if the route isn't registered it's added.
+// It's safe to call while serving.
+func (sn *Server) Replace(method, route string, routeFunc RequestFunc) *Route {
+	sn.routesMu.Lock()
+	defer sn.routesMu.Unlock()
+
+	rt := buildRoute(route, routeFunc)
+	if existing := sn.lookupRoute(method, rt.route); existing != nil {
+		rt.opts.Store(existing.options())
+	}
+
+	return sn.insertRoute(method, rt)
+}
 
-		// see if node already exists
-		if node, ok := currentNode.children[childKey]; ok {
-			currentNode = node
-		} else {
-			n := newNode()
-			currentNode.children[childKey] = n
-			currentNode = n
+// routeKeys returns the child keys leading to the node holding the route, params use an empty key.
+// The route is held in a child of the last part with the same key.
+func routeKeys(route string) []string {
+	parts := strings.Split(route, "/")
+	keys := make([]string, 0, len(parts)+1)
+	for _, val := range parts {
+		// if first character is a colon this part of path is a parameter set to an empty key
+		if len(val) > 1 && val[0] == ':' {
+			val = ""
 		}
 
-		// if at the last part of path set the child key to a new node
-		// with the route set to the incoming route
-		if index == len(parts)-1 {
-			node := newNode()
-			node.route = route
-			currentNode.children[childKey] = node
+		keys = append(keys, val)
+	}
+
+	return append(keys, keys[len(keys)-1])
+}
+
+// loadPaths returns the current route tree which must not be modified
+func (sn *Server) loadPaths() map[string]*Node {
+	paths, _ := sn.paths.Load().(map[string]*Node)
+	return paths
+}
+
+// copyPaths returns a shallow copy of the method nodes for building a new tree
+func (sn *Server) copyPaths() map[string]*Node {
+	current := sn.loadPaths()
+	paths := make(map[string]*Node, len(current)+1)
+	for method, node := range current {
+		paths[method] = node
+	}
+
+	return paths
+}
+
+// lookupRoute returns the route registered for exactly method and pattern
+func (sn *Server) lookupRoute(method, pattern string) *Route {
+	currentNode := sn.loadPaths()[method]
+	for _, key := range routeKeys(pattern) {
+		if currentNode == nil {
+			return nil
 		}
+
+		currentNode = currentNode.children[key]
 	}
+
+	if currentNode == nil {
+		return nil
+	}
+
+	return currentNode.route
 }
 
 func newNode() *Node {
@@ -174,18 +427,70 @@ func newNode() *Node {
 	}
 }
 
-// climbTree takes in path and traverses tree to find route
+// clone returns a copy of the node that can be modified without affecting the current tree, or a new node if n is nil
+func (n *Node) clone() *Node {
+	c := newNode()
+	if n == nil {
+		return c
+	}
+
+	c.route = n.route
+	for key, child := range n.children {
+		c.children[key] = child
+	}
+
+	return c
+}
+
+// remove returns a copy of n without the route at the end of keys, pruning nodes left empty
+func (n *Node) remove(keys []string) (*Node, bool) {
+	child, ok := n.children[keys[0]]
+	if !ok {
+		return n, false
+	}
+
+	var removed bool
+	if len(keys) == 1 {
+		removed = child.route != nil
+		child = child.clone()
+		child.route = nil
+	} else {
+		child, removed = child.remove(keys[1:])
+	}
+
+	if !removed {
+		return n, false
+	}
+
+	c := n.clone()
+	if child.route == nil && len(child.children) == 0 {
+		delete(c.children, keys[0])
+	} else {
+		c.children[keys[0]] = child
+	}
+
+	return c, true
+}
+
+// climbTree takes in path and traverses tree to find route, it's lock free as the tree is never modified
 func (sn *Server) climbTree(method, path string) *Route {
 	parts := strings.Split(path, "/")
+	paths := sn.loadPaths()
 
-	currentNode, ok := sn.paths[method]
+	currentNode, ok := paths[method]
 	if !ok {
-		currentNode, ok = sn.paths[""]
+		currentNode, ok = paths[""]
 		if !ok {
 			return nil
 		}
 	}
 
+	return currentNode.match(parts)
+}
+
+// match returns the route below the method node n matching the path parts
+func (n *Node) match(parts []string) *Route {
+	currentNode := n
 	for _, val := range parts {
 		var node *Node
 		node = currentNode.children[val]
@@ -215,11 +520,14 @@ func (sn *Server) climbTree(method, path string) *Route {
 func buildRoute(route string, routeFunc RequestFunc) *Route {
 	route = path.Clean(route)
 
-	return &Route{
+	rt := &Route{
 		routeFunc:        routeFunc,
 		routeParamsIndex: map[int]string{},
 		route:            route,
 	}
+	rt.opts.Store(&routeOptions{})
+
+	return rt
 }
 
 // Use adds a new function to the middleware stack
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -415,8 +417,8 @@ func TestServer_EnableDebug(t *testing.T) {
 	s := New()
 	s.EnableDebug(true)
 
-	if !s.debug {
-		t.Error("Debug mode wasn't set")
+	if s.accessLog == nil {
+		t.Error("Debug mode didn't enable the access log")
 	}
 }
 
@@ -483,3 +485,102 @@ func TestRouteGroup(t *testing.T) {
 		t.Error("couldn't get 200 from endpoint")
 	}
 }
+
+func TestServer_RemoveReplace(t *testing.T) {
+	s := New()
+	s.Get("/plugins/:name", func(req *Request) error {
+		return req.Send("v1")
+	}).BodyLimit(10)
+
+	s.Get("/plugins/:name/config", func(req *Request) error {
+		return req.Send("config")
+	})
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	s.Replace(http.MethodGet, "/plugins/:name", func(req *Request) error {
+		return req.Send("v2")
+	})
+
+	if _, body := get("/plugins/a"); body != "v2" {
+		t.Errorf("expected replaced handler got %q", body)
+	}
+
+	if rt := s.lookupRoute(http.MethodGet, "/plugins/:name"); rt == nil || rt.options().bodyLimit != 10 {
+		t.Error("expected the replaced route to keep its options")
+	}
+
+	if !s.Remove(http.MethodGet, "/plugins/:name") || s.Remove(http.MethodGet, "/plugins/:name") {
+		t.Error("expected the route to be removed once")
+	}
+
+	if code, _ := get("/plugins/a"); code != http.StatusNotFound {
+		t.Errorf("expected 404 after removal got %d", code)
+	}
+
+	if _, body := get("/plugins/a/config"); body != "config" {
+		t.Errorf("expected child route to remain got %q", body)
+	}
+}
+
+func TestServer_ConcurrentRegistration(t *testing.T) {
+	s := New()
+	s.Get("/static", func(req *Request) error {
+		return req.Send("ok")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			route := "/dynamic/" + strconv.Itoa(i%2)
+			s.Get(route, func(req *Request) error {
+				return req.Send("ok")
+			}).BodyLimit(1 << 20).Guard(func(req *Request) error {
+				return nil
+			})
+			s.Replace(http.MethodGet, route, func(req *Request) error {
+				return req.Send("replaced")
+			}).RequireRoles("admin")
+			s.Remove(http.MethodGet, route)
+		}
+	}()
+
+	// serve the routes being changed from several goroutines until the changes are done
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("expected static route to be served during registration got %d", w.Code)
+					return
+				}
+
+				w = httptest.NewRecorder()
+				s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dynamic/"+strconv.Itoa(i%2), nil))
+				switch w.Code {
+				case http.StatusOK, http.StatusUnauthorized, http.StatusNotFound:
+				default:
+					t.Errorf("unexpected status %d for a route being changed", w.Code)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
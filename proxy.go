@@ -0,0 +1,225 @@
+package nova
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// forwarding headers read from trusted proxies
+const (
+	HeaderForwarded       = "Forwarded"
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+	HeaderXForwardedHost  = "X-Forwarded-Host"
+)
+
+// TrustedProxies sets the addresses of proxies whose forwarding headers are used by Request.ClientIP,
+// Scheme and Host. Each entry is a CIDR such as 10.0.0.0/8 or a single IP.
+func (sn *Server) TrustedProxies(proxies ...string) error {
+	nets, err := parseCIDRs(proxies)
+	if err != nil {
+		return err
+	}
+
+	sn.trustedProxies = nets
+	return nil
+}
+
+// parseCIDRs parses CIDRs treating single IPs as a network of one address
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, errors.Errorf("invalid IP %q", c)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CIDR %q", c)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// containsIP reports whether ip is in any of the networks
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedInfo is the client address, scheme and host resolved through trusted proxies
+type forwardedInfo struct {
+	ip     string
+	scheme string
+	host   string
+}
+
+// forwardedHop is a single proxy hop from the forwarding headers
+type forwardedHop struct {
+	ip    string
+	proto string
+	host  string
+}
+
+// ClientIP returns the IP of the client. When the request comes from a trusted proxy the forwarding
+// headers are walked from the nearest hop and the first address that isn't a trusted proxy is returned.
+func (r *Request) ClientIP() string {
+	return r.forwarded().ip
+}
+
+// Scheme returns http or https as used by the client, honoring the forwarded protocol from trusted proxies
+func (r *Request) Scheme() string {
+	return r.forwarded().scheme
+}
+
+// Host returns the host requested by the client, honoring the forwarded host from trusted proxies
+func (r *Request) Host() string {
+	return r.forwarded().host
+}
+
+// forwarded resolves the client details once per request
+func (r *Request) forwarded() *forwardedInfo {
+	if r.forwardedInfo != nil {
+		return r.forwardedInfo
+	}
+
+	info := &forwardedInfo{ip: remoteIP(r.RemoteAddr), scheme: "http", host: r.Request.Host}
+	if r.TLS != nil {
+		info.scheme = "https"
+	}
+	r.forwardedInfo = info
+
+	if r.server == nil || len(r.server.trustedProxies) == 0 {
+		return info
+	}
+
+	trusted := r.server.trustedProxies
+	if ip := net.ParseIP(info.ip); ip == nil || !containsIP(trusted, ip) {
+		return info
+	}
+
+	hops := forwardedHops(r.Request.Header)
+	if len(hops) == 0 {
+		return info
+	}
+
+	// walk back from the hop added by the nearest proxy until reaching an address we don't trust
+	var hop forwardedHop
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i].ip)
+		if ip == nil {
+			// an unknown or obfuscated address can't be verified so stop at the last trusted proxy
+			break
+		}
+
+		hop = hops[i]
+		info.ip = ip.String()
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+
+	if hop.proto == "http" || hop.proto == "https" {
+		info.scheme = hop.proto
+	}
+
+	if hop.host != "" {
+		info.host = hop.host
+	}
+
+	return info
+}
+
+// forwardedHops returns the hops from the Forwarded header or the X-Forwarded headers if it isn't set.
+// The X-Forwarded-Proto and X-Forwarded-Host values set by the nearest proxy apply to every hop.
+func forwardedHops(h map[string][]string) []forwardedHop {
+	if values := h[HeaderForwarded]; len(values) > 0 {
+		return parseForwarded(values)
+	}
+
+	var hops []forwardedHop
+	proto := lastListValue(h[HeaderXForwardedProto])
+	host := lastListValue(h[HeaderXForwardedHost])
+	for _, v := range h[HeaderXForwardedFor] {
+		for _, ip := range strings.Split(v, ",") {
+			hops = append(hops, forwardedHop{ip: stripPort(strings.TrimSpace(ip)), proto: strings.ToLower(proto), host: host})
+		}
+	}
+
+	return hops
+}
+
+// lastListValue returns the last entry of a comma separated header
+func lastListValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	v := values[len(values)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+
+	return strings.TrimSpace(v)
+}
+
+// parseForwarded parses RFC 7239 Forwarded header values
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				eq := strings.IndexByte(pair, '=')
+				if eq < 0 {
+					continue
+				}
+
+				value := strings.Trim(strings.TrimSpace(pair[eq+1:]), `"`)
+				switch strings.ToLower(strings.TrimSpace(pair[:eq])) {
+				case "for":
+					hop.ip = stripPort(value)
+				case "proto":
+					hop.proto = strings.ToLower(value)
+				case "host":
+					hop.host = value
+				}
+			}
+
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// stripPort removes the port and IPv6 brackets from a forwarded address
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
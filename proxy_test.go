@@ -0,0 +1,68 @@
+package nova
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	s := New()
+	if err := s.TrustedProxies("10.0.0.0/8", "192.168.1.1", "2001:db8::/32"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got [3]string
+	s.Get("/", func(req *Request) error {
+		got = [3]string{req.ClientIP(), req.Scheme(), req.Host()}
+		return nil
+	})
+
+	tests := []struct {
+		remote   string
+		headers  map[string]string
+		expected [3]string
+	}{
+		// headers from an untrusted client are ignored
+		{"203.0.113.9:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1", HeaderXForwardedProto: "https"},
+			[3]string{"203.0.113.9", "http", "example.com"}},
+		// a spoofed leftmost entry is skipped as the walk stops at the first untrusted hop
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1, 198.51.100.7, 10.0.0.2",
+			HeaderXForwardedProto: "https", HeaderXForwardedHost: "api.example.com"},
+			[3]string{"198.51.100.7", "https", "api.example.com"}},
+		// every hop trusted returns the furthest
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "192.168.1.1, 10.0.0.2"},
+			[3]string{"192.168.1.1", "http", "example.com"}},
+		// RFC 7239 with quoted IPv6 and ports
+		{"[2001:db8::1]:443", map[string]string{HeaderForwarded: `for="[2001:db9::17]:4711";proto=https;host=shop.example.com, for=10.1.1.1`},
+			[3]string{"2001:db9::17", "https", "shop.example.com"}},
+		// obfuscated identifiers stop the walk at the last trusted proxy
+		{"10.0.0.1:1234", map[string]string{HeaderForwarded: "for=_hidden, for=10.0.0.9"},
+			[3]string{"10.0.0.9", "http", "example.com"}},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = test.remote
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		s.ServeHTTP(httptest.NewRecorder(), req)
+		if got != test.expected {
+			t.Errorf("from %s with %v expected %v got %v", test.remote, test.headers, test.expected, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://secure.example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if got[1] != "https" || got[2] != "secure.example.com" {
+		t.Errorf("expected scheme and host from the TLS request got %v", got)
+	}
+
+	if err := s.TrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected an invalid CIDR to fail")
+	}
+}
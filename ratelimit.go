@@ -0,0 +1,344 @@
+package nova
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rate limit response headers
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// RateLimitAlgorithm decides how requests are counted against a limit
+type RateLimitAlgorithm int
+
+// rate limit algorithms
+const (
+	// TokenBucket refills the bucket evenly over the window allowing bursts up to its size
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow counts requests in the last window weighting the previous window by how much of it overlaps
+	SlidingWindow
+)
+
+// RateLimit is the limit applied to each key
+type RateLimit struct {
+	// Limit is the number of requests allowed each Window
+	Limit  int
+	Window time.Duration
+
+	// Burst is the token bucket size, defaults to Limit
+	Burst int
+
+	Algorithm RateLimitAlgorithm
+}
+
+// RateLimitResult is the outcome of taking a request from a key's limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is how long until the limit is fully restored
+	Reset time.Duration
+
+	// RetryAfter is how long until another request is allowed when Allowed is false
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of each key, implement it to share limits between instances
+type RateLimitStore interface {
+	// Take counts a request against the key's limit
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns the key a request is limited by, requests with an empty key aren't limited
+type RateLimitKeyFunc func(r *Request) string
+
+// RateLimitOptions configures rate limiting middleware
+type RateLimitOptions struct {
+	RateLimit
+
+	// Key groups requests that share a limit, defaults to KeyByIP
+	Key RateLimitKeyFunc
+
+	// Store keeps the limit state, defaults to a new MemoryStore.
+	// Requests are allowed if the store returns an error unless FailClosed is set.
+	Store RateLimitStore
+
+	// FailClosed responds with 503 Service Unavailable when the store returns an error
+	FailClosed bool
+
+	// OnError is called with errors returned by the store, they're ignored if it's nil
+	OnError func(r *Request, err error)
+}
+
+// KeyByIP limits requests by the client IP, resolved through trusted proxies
+func KeyByIP(r *Request) string {
+	return r.ClientIP()
+}
+
+// KeyByHeader limits requests by the value of a header such as an API key,
+// requests without the header aren't limited
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(r *Request) string {
+		if v := r.Request.Header.Get(header); v != "" {
+			return header + ":" + v
+		}
+
+		return ""
+	}
+}
+
+// KeyByRoute limits requests to each route pattern separately for every key returned by key
+func KeyByRoute(key RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(r *Request) string {
+		k := key(r)
+		if k == "" {
+			return ""
+		}
+
+		pattern := unmatchedRoute
+		if r.server != nil {
+			if route := r.server.climbTree(r.GetMethod(), cleanPath(r.URL.Path)); route != nil {
+				pattern = route.route
+			}
+		}
+
+		return r.GetMethod() + " " + pattern + "|" + k
+	}
+}
+
+// RateLimiter returns middleware that responds with 429 Too Many Requests once a key has used its limit.
+// Every limited response includes the RateLimit headers. Register it with Server.Use.
+func RateLimiter(opts RateLimitOptions) func(*Request, func()) {
+	if opts.Limit <= 0 || opts.Window <= 0 {
+		panic("nova: rate limit needs a positive limit and window")
+	}
+
+	if opts.Burst <= 0 {
+		opts.Burst = opts.Limit
+	}
+
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore(0)
+	}
+
+	// the token bucket's quota is its size which takes Window * Burst / Limit to refill
+	quota, window := opts.Limit, opts.Window
+	if opts.Algorithm == TokenBucket {
+		quota = opts.Burst
+		window = time.Duration(float64(opts.Window) * float64(opts.Burst) / float64(opts.Limit))
+	}
+
+	limit := strconv.Itoa(quota)
+	policy := limit + ";w=" + ceilSeconds(window)
+
+	return func(req *Request, next func()) {
+		key := opts.Key(req)
+		if key == "" {
+			next()
+			return
+		}
+
+		res, err := opts.Store.Take(req.Context(), key, opts.RateLimit)
+		if err != nil {
+			if opts.OnError != nil {
+				opts.OnError(req, err)
+			}
+
+			if opts.FailClosed {
+				req.Error(http.StatusServiceUnavailable, "rate limit unavailable", nil)
+				return
+			}
+
+			next()
+			return
+		}
+
+		h := req.Header()
+		h.Set(HeaderRateLimitPolicy, policy)
+		h.Set(HeaderRateLimitLimit, limit)
+		h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+		h.Set(HeaderRateLimitReset, ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			h.Set(HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+			req.Error(http.StatusTooManyRequests, "rate limit exceeded", nil)
+			return
+		}
+
+		next()
+	}
+}
+
+// ceilSeconds formats d as whole seconds rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// DefaultRateLimitShards is the number of shards a MemoryStore uses when none is set
+const DefaultRateLimitShards = 64
+
+// MemoryStore keeps rate limit state in memory split across shards to reduce lock contention.
+// Keys that haven't been used for longer than their window are removed.
+type MemoryStore struct {
+	shards []*limitShard
+	now    func() time.Time
+}
+
+// limitShard holds the state for a subset of keys
+type limitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*limitEntry
+	lastSweep time.Time
+}
+
+// limitEntry is the state of a single key
+type limitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	windowStart time.Time
+	prev, curr  int
+
+	expires time.Time
+}
+
+// NewMemoryStore returns an in memory store with n shards, defaults to DefaultRateLimitShards
+func NewMemoryStore(n int) *MemoryStore {
+	if n <= 0 {
+		n = DefaultRateLimitShards
+	}
+
+	s := &MemoryStore{shards: make([]*limitShard, n), now: time.Now}
+	for i := range s.shards {
+		s.shards[i] = &limitShard{entries: map[string]*limitEntry{}}
+	}
+
+	return s
+}
+
+// Take implements RateLimitStore
+func (s *MemoryStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	now := s.now()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.sweep(now, limit.Window)
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &limitEntry{tokens: float64(burst(limit)), last: now, windowStart: now.Truncate(limit.Window)}
+		shard.entries[key] = e
+	}
+
+	// keep the entry until it no longer affects the result
+	if limit.Algorithm == SlidingWindow {
+		e.expires = now.Add(2 * limit.Window)
+		return e.slidingWindow(now, limit), nil
+	}
+
+	e.expires = now.Add(time.Duration(float64(limit.Window) * math.Max(1, float64(burst(limit))/float64(limit.Limit))))
+	return e.tokenBucket(now, limit), nil
+}
+
+// sweep removes expired entries at most once a window
+func (s *limitShard) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func burst(limit RateLimit) int {
+	if limit.Burst > 0 {
+		return limit.Burst
+	}
+
+	return limit.Limit
+}
+
+// tokenBucket refills the bucket for the time since the last request and takes a token
+func (e *limitEntry) tokenBucket(now time.Time, limit RateLimit) RateLimitResult {
+	size := float64(burst(limit))
+	perSecond := float64(limit.Limit) / limit.Window.Seconds()
+
+	e.tokens = math.Min(size, e.tokens+now.Sub(e.last).Seconds()*perSecond)
+	e.last = now
+
+	res := RateLimitResult{Limit: int(size)}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsDuration((1 - e.tokens) / perSecond)
+	}
+
+	res.Remaining = int(e.tokens)
+	res.Reset = secondsDuration((size - e.tokens) / perSecond)
+	return res
+}
+
+// slidingWindow estimates the requests in the last window from the current and previous fixed windows
+func (e *limitEntry) slidingWindow(now time.Time, limit RateLimit) RateLimitResult {
+	start := now.Truncate(limit.Window)
+	switch windows := int(start.Sub(e.windowStart) / limit.Window); {
+	case windows == 1:
+		e.prev, e.curr = e.curr, 0
+	case windows > 1:
+		e.prev, e.curr = 0, 0
+	}
+	e.windowStart = start
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(limit.Window)
+	count := float64(e.prev)*weight + float64(e.curr)
+
+	res := RateLimitResult{Limit: limit.Limit, Reset: limit.Window - elapsed}
+	if count+1 <= float64(limit.Limit) {
+		e.curr++
+		res.Allowed = true
+		count++
+	} else if e.prev == 0 || e.curr >= limit.Limit {
+		// nothing from the previous window is left to expire so wait for the next window
+		res.RetryAfter = limit.Window - elapsed
+	} else {
+		// wait until enough of the previous window has slid out for one more request
+		needed := 1 - float64(limit.Limit-1-e.curr)/float64(e.prev)
+		res.RetryAfter = time.Duration(needed*float64(limit.Window)) - elapsed
+	}
+
+	res.Remaining = int(math.Max(0, math.Floor(float64(limit.Limit)-count)))
+	return res
+}
+
+// secondsDuration converts fractional seconds to a duration
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,170 @@
+package nova
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	store := NewMemoryStore(4)
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	s := New()
+	s.Use(RateLimiter(RateLimitOptions{
+		RateLimit: RateLimit{Limit: 2, Window: time.Minute},
+		Key:       KeyByHeader("X-API-Key"),
+		Store:     store,
+	}))
+	s.Get("/", func(req *Request) error {
+		return req.Send("ok")
+	})
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := get("a")
+		if w.Code != http.StatusOK || w.Header().Get(HeaderRateLimitRemaining) != remaining {
+			t.Errorf("request %d expected 200 with %s remaining got %d %v", i, remaining, w.Code, w.Header())
+		}
+	}
+
+	w := get("a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(HeaderRetryAfter) != "30" {
+		t.Errorf("expected 429 retrying after 30s got %d %v", w.Code, w.Header())
+	}
+
+	if w.Header().Get(HeaderRateLimitPolicy) != "2;w=60" || w.Header().Get(HeaderRateLimitReset) != "60" {
+		t.Errorf("unexpected rate limit headers %v", w.Header())
+	}
+
+	if w := get("b"); w.Code != http.StatusOK {
+		t.Error("expected another key to have its own limit")
+	}
+
+	if w := get(""); w.Code != http.StatusOK || w.Header().Get(HeaderRateLimitLimit) != "" {
+		t.Error("expected requests without a key not to be limited")
+	}
+
+	now = now.Add(30 * time.Second)
+	if w := get("a"); w.Code != http.StatusOK {
+		t.Errorf("expected a token to refill after 30s got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_Headers(t *testing.T) {
+	s := New()
+	s.Use(RateLimiter(RateLimitOptions{
+		RateLimit: RateLimit{Limit: 2, Window: time.Minute, Burst: 4},
+	}))
+	s.Get("/", func(req *Request) error {
+		return req.Send("ok")
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get(HeaderRateLimitLimit) != "4" || w.Header().Get(HeaderRateLimitPolicy) != "4;w=120" {
+		t.Errorf("expected the limit and policy to report the bucket size got %v", w.Header())
+	}
+}
+
+// errorStore fails every request
+type errorStore struct{}
+
+func (errorStore) Take(context.Context, string, RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store unavailable")
+}
+
+func TestRateLimiter_StoreError(t *testing.T) {
+	for _, failClosed := range []bool{false, true} {
+		var reported error
+		s := New()
+		s.Use(RateLimiter(RateLimitOptions{
+			RateLimit:  RateLimit{Limit: 1, Window: time.Minute},
+			Store:      errorStore{},
+			FailClosed: failClosed,
+			OnError: func(r *Request, err error) {
+				reported = err
+			},
+		}))
+		s.Get("/", func(req *Request) error {
+			return req.Send("ok")
+		})
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		expected := http.StatusOK
+		if failClosed {
+			expected = http.StatusServiceUnavailable
+		}
+
+		if w.Code != expected || reported == nil {
+			t.Errorf("fail closed %t expected %d with the error reported got %d %v", failClosed, expected, w.Code, reported)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryStore(1)
+	start := time.Unix(1700000040, 0).Truncate(time.Minute)
+	now := start
+	store.now = func() time.Time { return now }
+
+	limit := RateLimit{Limit: 4, Window: time.Minute, Algorithm: SlidingWindow}
+	for i := 0; i < 4; i++ {
+		if res, _ := store.Take(context.Background(), "k", limit); !res.Allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+
+	if res, _ := store.Take(context.Background(), "k", limit); res.Allowed || res.RetryAfter != time.Minute {
+		t.Errorf("expected the window to be full got %+v", res)
+	}
+
+	// a quarter into the next window three quarters of the previous window still counts
+	now = start.Add(75 * time.Second)
+	if res, _ := store.Take(context.Background(), "k", limit); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expected one request to be allowed got %+v", res)
+	}
+
+	res, _ := store.Take(context.Background(), "k", limit)
+	if res.Allowed || res.RetryAfter != 15*time.Second {
+		t.Errorf("expected to retry once another quarter of the window has passed got %+v", res)
+	}
+}
+
+func TestKeyByRoute(t *testing.T) {
+	s := New()
+	var keys []string
+	key := KeyByRoute(KeyByIP)
+	s.Use(func(req *Request, next func()) {
+		keys = append(keys, key(req))
+		next()
+	})
+	s.Get("/users/:id", func(req *Request) error {
+		return nil
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if keys[0] != "GET /users/:id|192.0.2.1" || keys[1] != keys[0] || keys[2] != "GET unmatched|192.0.2.1" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
@@ -17,13 +17,41 @@ type Request struct {
 	queryParams    url.Values
 	BaseUrl        string
 	ResponseCode   int
+
+	// functions to run once the request has been handled
+	finishFuncs []func()
+
+	// tracks what has been written to the client
+	rw *responseWriter
+
+	// limits how much of the body can be read
+	bodyReader *maxReader
+
+	// the route matched for the request
+	route *Route
+
+	// start of the body kept for slow request logs
+	bodySnapshot *snapshotBody
+
+	// correlation id assigned to the request
+	requestID string
+
+	// phases timed for the Server-Timing header
+	timing *serverTiming
+
+	// server handling the request
+	server *Server
+
+	// client details resolved through trusted proxies
+	forwardedInfo *forwardedInfo
 }
 
 // JSONError resembles the RESTful standard for an error response
 type JSONError struct {
-	Code    int      `json:"code"`
-	Errors  []string `json:"errors"`
-	Message string   `json:"message"`
+	Code      int      `json:"code"`
+	Errors    []string `json:"errors"`
+	Message   string   `json:"message"`
+	RequestID string   `json:"request_id,omitempty"`
 }
 
 // JSONErrors holds the JSONError response
@@ -36,7 +64,8 @@ func NewRequest(w http.ResponseWriter, r *http.Request) *Request {
 	req := new(Request)
 	req.Request = r
 	req.routeParams = make(map[string]string)
-	req.ResponseWriter = w
+	req.rw = &responseWriter{ResponseWriter: w, req: req}
+	req.ResponseWriter = req.rw
 	req.queryParams = r.URL.Query()
 	req.BaseUrl = r.RequestURI
 
@@ -54,6 +83,15 @@ func (r *Request) RouteParam(key string) string {
 	return ""
 }
 
+// RoutePattern returns the pattern of the matched route such as /users/:id or "" if no route matched
+func (r *Request) RoutePattern() string {
+	if r.route == nil {
+		return ""
+	}
+
+	return r.route.route
+}
+
 // QueryParam checks for and returns param or "" if doesn't exist
 func (r *Request) QueryParam(key string) string {
 	return r.queryParams.Get(key)
@@ -64,8 +102,9 @@ func (r *Request) Error(statusCode int, msg string, userErr error) error {
 	// Format error response
 	newErr := JSONErrors{
 		Error: JSONError{
-			Code:    statusCode,
-			Message: msg,
+			Code:      statusCode,
+			Message:   msg,
+			RequestID: r.requestID,
 		},
 	}
 
@@ -83,6 +122,36 @@ func (r *Request) Error(statusCode int, msg string, userErr error) error {
 	return userErr
 }
 
+// BytesWritten returns the number of response body bytes sent to the client
+func (r *Request) BytesWritten() int64 {
+	return r.rw.size
+}
+
+// HeaderWritten reports whether the response status has been sent to the client, or has been
+// written to a middleware writer such as Compress that hasn't sent it yet
+func (r *Request) HeaderWritten() bool {
+	return r.rw.wroteHeader || r.rw.committed
+}
+
+// BeforeWriteHeader registers a function to be run just before the response status and headers
+// are sent so it can still modify the headers
+func (r *Request) BeforeWriteHeader(f func()) {
+	r.rw.beforeHeader = append(r.rw.beforeHeader, f)
+}
+
+// OnFinish registers a function to be run after the request has been handled.
+// Functions are run in the reverse order they were registered.
+func (r *Request) OnFinish(f func()) {
+	r.finishFuncs = append(r.finishFuncs, f)
+}
+
+// finish runs the registered finish functions
+func (r *Request) finish() {
+	for i := len(r.finishFuncs) - 1; i >= 0; i-- {
+		r.finishFuncs[i]()
+	}
+}
+
 // buildRouteParams builds a map of the route params
 func (r *Request) buildRouteParams(route string) {
 	routeParams := r.routeParams
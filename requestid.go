@@ -0,0 +1,157 @@
+package nova
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// DefaultRequestIDHeader is the header request IDs are read from and echoed in
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest inbound request ID accepted
+const maxRequestIDLength = 128
+
+// RequestIDOptions configures how request IDs are assigned
+type RequestIDOptions struct {
+	// Header the ID is read from and echoed in, defaults to DefaultRequestIDHeader
+	Header string
+
+	// TrustInbound uses a valid ID sent by the client instead of generating one
+	TrustInbound bool
+
+	// Generator creates new IDs, defaults to NewRequestID
+	Generator func() string
+
+	// Validator reports whether an inbound ID can be used, defaults to ValidRequestID
+	Validator func(id string) bool
+}
+
+// EnableRequestID assigns every request an ID that's exposed with Request.RequestID,
+// echoed in the response header and included in access logs and error responses
+func (sn *Server) EnableRequestID(opts RequestIDOptions) {
+	if opts.Header == "" {
+		opts.Header = DefaultRequestIDHeader
+	}
+
+	if opts.Generator == nil {
+		opts.Generator = NewRequestID
+	}
+
+	if opts.Validator == nil {
+		opts.Validator = ValidRequestID
+	}
+
+	sn.requestID = &opts
+}
+
+// assignRequestID sets the ID for the request and echoes it to the client
+func (o *RequestIDOptions) assignRequestID(r *Request) {
+	id := ""
+	if o.TrustInbound {
+		if inbound := r.Request.Header.Get(o.Header); inbound != "" && o.Validator(inbound) {
+			id = inbound
+		}
+	}
+
+	if id == "" {
+		id = o.Generator()
+	}
+
+	r.requestID = id
+	r.Header().Set(o.Header, id)
+}
+
+// RequestID returns the ID assigned to the request or "" if request IDs aren't enabled
+func (r *Request) RequestID() string {
+	return r.requestID
+}
+
+// ValidRequestID reports whether id is at most 128 characters of letters, digits and - _ . :
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// crockford is the base32 alphabet used for request IDs, it sorts in byte order
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idGenerator creates lexically sortable IDs made of a millisecond timestamp and random bits.
+// IDs made in the same millisecond increment the random bits so they still sort in order.
+type idGenerator struct {
+	mu     sync.Mutex
+	lastMs uint64
+	last   [16]byte
+}
+
+var requestIDs idGenerator
+
+// NewRequestID returns a new 26 character ID that sorts by the time it was created
+func NewRequestID() string {
+	return requestIDs.next(time.Now())
+}
+
+// next returns the ID for time t
+func (g *idGenerator) next(t time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(t.UnixMilli())
+	if ms <= g.lastMs {
+		// increment the random bits, carrying into the timestamp on overflow
+		for i := 15; i >= 0; i-- {
+			g.last[i]++
+			if g.last[i] != 0 {
+				break
+			}
+		}
+
+		g.lastMs = 0
+		for i := 0; i < 6; i++ {
+			g.lastMs = g.lastMs<<8 | uint64(g.last[i])
+		}
+	} else {
+		g.lastMs = ms
+		for i := 0; i < 6; i++ {
+			g.last[i] = byte(ms >> (40 - 8*uint(i)))
+		}
+
+		rand.Read(g.last[6:])
+	}
+
+	return encodeID(g.last)
+}
+
+// encodeID encodes the 128 bits as 26 base32 characters
+func encodeID(b [16]byte) string {
+	var out [26]byte
+
+	// 130 bits of output so the first character holds the top 3 bits
+	var acc uint64
+	bits := uint(2)
+	j := 0
+	for _, v := range b {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[j] = crockford[(acc>>bits)&31]
+			j++
+		}
+	}
+
+	return string(out[:])
+}
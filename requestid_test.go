@@ -0,0 +1,87 @@
+package nova
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestServer_EnableRequestID(t *testing.T) {
+	s := New()
+	s.EnableRequestID(RequestIDOptions{TrustInbound: true})
+	s.Get("/test", func(r *Request) error {
+		return r.Error(http.StatusTeapot, "no coffee", nil)
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tests := map[string]bool{
+		"":                 false,
+		"abc-123":          true,
+		"bad id with \"\"": false,
+	}
+
+	for inbound, kept := range tests {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/test", nil)
+		if inbound != "" {
+			req.Header.Set(DefaultRequestIDHeader, inbound)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var e JSONErrors
+		json.NewDecoder(res.Body).Decode(&e)
+		res.Body.Close()
+
+		id := res.Header.Get(DefaultRequestIDHeader)
+		if kept && id != inbound {
+			t.Errorf("expected inbound id %q got %q", inbound, id)
+		}
+
+		if !kept && (id == inbound || len(id) != 26) {
+			t.Errorf("expected generated id got %q", id)
+		}
+
+		if e.Error.RequestID != id {
+			t.Errorf("expected error body to include %q got %q", id, e.Error.RequestID)
+		}
+	}
+}
+
+func TestNewRequestID_Sortable(t *testing.T) {
+	var g idGenerator
+	now := time.Now()
+	ids := []string{g.next(now), g.next(now), g.next(now.Add(time.Millisecond)), g.next(now.Add(time.Hour))}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("ids aren't sorted %v", ids)
+	}
+
+	if ids[0] == ids[1] {
+		t.Error("ids in the same millisecond should be unique")
+	}
+}
+
+func TestNewRequestID_Overflow(t *testing.T) {
+	var g idGenerator
+	now := time.Now()
+	first := g.next(now)
+	for i := 6; i < 16; i++ {
+		g.last[i] = 0xff
+	}
+
+	full := encodeID(g.last)
+	carried := g.next(now)
+	later := g.next(now.Add(time.Millisecond))
+
+	if ids := []string{first, full, carried, later}; !sort.StringsAreSorted(ids) || carried == later {
+		t.Errorf("expected overflowing the random bits to carry into the timestamp got %v", ids)
+	}
+}
@@ -0,0 +1,82 @@
+package nova
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// responseWriter tracks the status and size of the response written for a Request
+type responseWriter struct {
+	http.ResponseWriter
+	req *Request
+
+	wroteHeader bool
+	size        int64
+
+	// set when the handler has sent the status to a writer that's still buffering it
+	committed bool
+
+	// run before the status is sent
+	beforeHeader []func()
+}
+
+// WriteHeader sends the status code and records it on the Request
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	// informational responses aren't the final header
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.wroteHeader = true
+	for _, f := range w.beforeHeader {
+		f()
+	}
+
+	w.req.ResponseCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the connection, sending a 200 if no status has been sent
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter doesn't support hijacking")
+	}
+
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,209 @@
+package nova
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RotateOptions configures when a RotatingFile starts a new file
+type RotateOptions struct {
+	// MaxSize rotates the file once writing would take it past this many bytes, 0 disables size rotation
+	MaxSize int64
+
+	// Daily rotates the file at the first write after midnight local time
+	Daily bool
+
+	// MaxBackups is the number of rotated files to keep, 0 keeps them all
+	MaxBackups int
+}
+
+// RotatingFile is an io.WriteCloser that writes to a file and moves it aside when it grows too large
+// or a new day starts. Rotated files are named after the file with the time of rotation appended.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	day  time.Time
+	now  func() time.Time
+}
+
+// NewRotatingFile opens or creates the file at path for appending
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path: path,
+		opts: opts,
+		now:  time.Now,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// open opens the current file and records its size and day
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to open log file")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to stat log file")
+	}
+
+	rf.f = f
+	rf.size = info.Size()
+	rf.day = startOfDay(rf.now())
+	return nil
+}
+
+// Write writes p to the file rotating it first if needed
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := rf.now()
+	sizeExceeded := rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.opts.MaxSize
+	dayChanged := rf.opts.Daily && !startOfDay(now).Equal(rf.day)
+	if sizeExceeded || dayChanged {
+		if err := rf.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.rotate(rf.now())
+}
+
+// rotate renames the current file with a timestamp suffix and opens a new file
+func (rf *RotatingFile) rotate(now time.Time) error {
+	if rf.f != nil {
+		if err := rf.f.Close(); err != nil {
+			return errors.Wrap(err, "unable to close log file")
+		}
+		rf.f = nil
+	}
+
+	// daily files are named after the day they hold
+	stamp := now.Format("20060102-150405")
+	if rf.opts.Daily && !startOfDay(now).Equal(rf.day) {
+		stamp = rf.day.Format("20060102")
+	}
+
+	backup := rf.path + "." + stamp
+	for i := 1; fileExists(backup); i++ {
+		backup = rf.path + "." + stamp + "." + strconv.Itoa(i)
+	}
+
+	if err := os.Rename(rf.path, backup); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to rotate log file")
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	return rf.removeBackups()
+}
+
+// removeBackups deletes the oldest rotated files past MaxBackups
+func (rf *RotatingFile) removeBackups() error {
+	if rf.opts.MaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	backups := matches[:0]
+	for _, m := range matches {
+		if suffix := strings.TrimPrefix(m, rf.path+"."); suffix != "" && suffix[0] >= '0' && suffix[0] <= '9' {
+			backups = append(backups, m)
+		}
+	}
+
+	if len(backups) <= rf.opts.MaxBackups {
+		return nil
+	}
+
+	// oldest first by their last write
+	sort.Slice(backups, func(i, j int) bool {
+		ti, tj := modTime(backups[i]), modTime(backups[j])
+		if ti.Equal(tj) {
+			return backups[i] < backups[j]
+		}
+
+		return ti.Before(tj)
+	})
+
+	for _, b := range backups[:len(backups)-rf.opts.MaxBackups] {
+		if err := os.Remove(b); err != nil {
+			return errors.Wrap(err, "unable to remove old log file")
+		}
+	}
+
+	return nil
+}
+
+// Close closes the current file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return nil
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+// startOfDay returns midnight of the day t falls on
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -3,6 +3,9 @@ package nova
 import (
 	"net/http"
 	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Route is the construct of a single route pattern
@@ -10,14 +13,128 @@ type Route struct {
 	routeFunc        RequestFunc
 	routeParamsIndex map[int]string
 	route            string
+
+	// holds the *routeOptions, they're replaced rather than modified so they can be changed while serving
+	opts atomic.Value
+
+	// held while replacing the options
+	mu sync.Mutex
+}
+
+// routeOptions are the settings of a route
+type routeOptions struct {
+	// maximum body size in bytes, 0 uses the server limit
+	bodyLimit int64
+
+	// deadline for reading the body, 0 uses the server timeout
+	bodyReadTimeout time.Duration
+
+	// overrides whether the Server-Timing header is sent when set
+	serverTiming *bool
+
+	// overrides the server CORS policy when set
+	cors *corsPolicy
+
+	// run in order before the route func, the first error stops the request
+	guards []RequestFunc
+
+	// authorization checked once the guards have run
+	requirements []requirement
+}
+
+// RouteOption configures a route before it's added so it's never served without it.
+// The Route methods of the same name can change a route while it's served.
+type RouteOption func(r *Route)
+
+// WithBodyLimit sets the route's body size limit, see Route.BodyLimit
+func WithBodyLimit(n int64) RouteOption {
+	return func(r *Route) { r.BodyLimit(n) }
+}
+
+// WithBodyReadTimeout sets the route's body read timeout, see Route.BodyReadTimeout
+func WithBodyReadTimeout(d time.Duration) RouteOption {
+	return func(r *Route) { r.BodyReadTimeout(d) }
+}
+
+// WithGuard adds a guard to the route, see Route.Guard
+func WithGuard(g RequestFunc) RouteOption {
+	return func(r *Route) { r.Guard(g) }
+}
+
+// WithRoles only allows principals with every role, see Route.RequireRoles
+func WithRoles(roles ...string) RouteOption {
+	return func(r *Route) { r.RequireRoles(roles...) }
+}
+
+// WithScopes only allows principals with every scope, see Route.RequireScopes
+func WithScopes(scopes ...string) RouteOption {
+	return func(r *Route) { r.RequireScopes(scopes...) }
+}
+
+// WithPolicy only allows principals the named policy allows, see Route.Authorize
+func WithPolicy(name string, policy PolicyFunc) RouteOption {
+	return func(r *Route) { r.Authorize(name, policy) }
+}
+
+// options returns the route's current options which must not be modified
+func (r *Route) options() *routeOptions {
+	o, _ := r.opts.Load().(*routeOptions)
+	return o
+}
+
+// update applies f to a copy of the route's options and swaps it in,
+// requests being served see either the old or the new options
+func (r *Route) update(f func(o *routeOptions)) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	o := *r.options()
+	f(&o)
+	r.opts.Store(&o)
+	return r
 }
 
 // call builds the route params & executes the function tied to the route
 func (r *Route) call(req *Request) error {
+	opts := r.options()
 	req.buildRouteParams(r.route)
+	for _, guard := range opts.guards {
+		if err := guard(req); err != nil {
+			return err
+		}
+	}
+
+	if err := authorize(opts.requirements, req); err != nil {
+		return err
+	}
+
 	return r.routeFunc(req)
 }
 
+// Guard adds a func that runs after the route has matched and before its handler. Returning an error
+// stops the request and passes the error to the error func.
+func (r *Route) Guard(g RequestFunc) *Route {
+	return r.update(func(o *routeOptions) {
+		o.guards = append(append([]RequestFunc(nil), o.guards...), g)
+	})
+}
+
+// BodyLimit sets the maximum number of bytes that can be read from the request body,
+// overriding the server limit. NoBodyLimit removes the limit for this route.
+func (r *Route) BodyLimit(n int64) *Route {
+	return r.update(func(o *routeOptions) {
+		o.bodyLimit = n
+	})
+}
+
+// BodyReadTimeout sets how long the handler has to read the request body,
+// overriding the server timeout. NoBodyLimit removes the timeout for this route.
+func (r *Route) BodyReadTimeout(d time.Duration) *Route {
+	return r.update(func(o *routeOptions) {
+		o.bodyReadTimeout = d
+	})
+}
+
 // RouteGroup is used to add routes prepending a base path
 type RouteGroup struct {
 	// server to add the route to
@@ -25,40 +142,86 @@ type RouteGroup struct {
 
 	// base path to prepend the path
 	path string
+
+	// defaults applied to routes added to the group
+	bodyLimit       int64
+	bodyReadTimeout time.Duration
+	serverTiming    *bool
+	cors            *corsPolicy
+	guards          []RequestFunc
+	requirements    []requirement
+}
+
+// BodyLimit sets the body size limit for routes added to the group after it is called
+func (r *RouteGroup) BodyLimit(n int64) *RouteGroup {
+	r.bodyLimit = n
+	return r
+}
+
+// BodyReadTimeout sets the body read timeout for routes added to the group after it is called
+func (r *RouteGroup) BodyReadTimeout(d time.Duration) *RouteGroup {
+	r.bodyReadTimeout = d
+	return r
+}
+
+// Guard adds a func that runs before the handler of routes added to the group after it's called,
+// returning an error stops the request and passes the error to the error func
+func (r *RouteGroup) Guard(g RequestFunc) *RouteGroup {
+	r.guards = append(r.guards, g)
+	return r
 }
 
 // All adds route for all http methods
-func (r *RouteGroup) All(route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute("", buildRoute(route, routeFunc))
+func (r *RouteGroup) All(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute("", route, routeFunc, opts)
 }
 
 // Get adds only GET method to route
-func (r *RouteGroup) Get(route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute(http.MethodGet, buildRoute(route, routeFunc))
+func (r *RouteGroup) Get(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute(http.MethodGet, route, routeFunc, opts)
 }
 
 // Post adds only POST method to route
-func (r *RouteGroup) Post(route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute(http.MethodPost, buildRoute(route, routeFunc))
+func (r *RouteGroup) Post(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute(http.MethodPost, route, routeFunc, opts)
 }
 
 // Put adds only PUT method to route
-func (r *RouteGroup) Put(route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute(http.MethodPut, buildRoute(route, routeFunc))
+func (r *RouteGroup) Put(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute(http.MethodPut, route, routeFunc, opts)
 }
 
 // Delete adds only DELETE method to route
-func (r *RouteGroup) Delete(route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute(http.MethodDelete, buildRoute(route, routeFunc))
+func (r *RouteGroup) Delete(route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute(http.MethodDelete, route, routeFunc, opts)
 }
 
 // Restricted adds route that is restricted by method
-func (r *RouteGroup) Restricted(method, route string, routeFunc RequestFunc) {
-	route = path.Join(r.path, route)
-	r.s.addRoute(method, buildRoute(route, routeFunc))
+func (r *RouteGroup) Restricted(method, route string, routeFunc RequestFunc, opts ...RouteOption) *Route {
+	return r.addRoute(method, route, routeFunc, opts)
+}
+
+// addRoute prepends the group path and applies the group defaults and options to the new route
+func (r *RouteGroup) addRoute(method, route string, routeFunc RequestFunc, opts []RouteOption) *Route {
+	rt := buildRoute(path.Join(r.path, route), routeFunc)
+	rt.opts.Store(&routeOptions{
+		bodyLimit:       r.bodyLimit,
+		bodyReadTimeout: r.bodyReadTimeout,
+		serverTiming:    r.serverTiming,
+		cors:            r.cors,
+		guards:          append([]RequestFunc(nil), r.guards...),
+		requirements:    append([]requirement(nil), r.requirements...),
+	})
+
+	return r.s.addRoute(method, rt, opts)
+}
+
+// Remove removes a route added to the group, it's safe to call while serving
+func (r *RouteGroup) Remove(method, route string) bool {
+	return r.s.Remove(method, path.Join(r.path, route))
+}
+
+// Replace swaps the handler of a route in the group keeping its options, it's safe to call while serving
+func (r *RouteGroup) Replace(method, route string, routeFunc RequestFunc) *Route {
+	return r.s.Replace(method, path.Join(r.path, route), routeFunc)
 }
@@ -0,0 +1,137 @@
+package nova
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerTimingHeader is the response header timings are sent in
+const ServerTimingHeader = "Server-Timing"
+
+// serverTiming holds the phases timed for a request
+type serverTiming struct {
+	mu      sync.Mutex
+	start   time.Time
+	phases  []timingPhase
+	handler time.Time
+}
+
+// timingPhase is a single named duration
+type timingPhase struct {
+	name string
+	desc string
+	dur  time.Duration
+}
+
+// EnableServerTiming sets whether responses include a Server-Timing header with the router,
+// middleware and handler durations along with any recorded with Request.AddTiming.
+// Route groups can override it with RouteGroup.ServerTiming.
+func (sn *Server) EnableServerTiming(enabled bool) {
+	sn.serverTiming = enabled
+	sn.timingUsed = true
+}
+
+// ServerTiming overrides whether routes added to the group after it's called send a Server-Timing header
+func (r *RouteGroup) ServerTiming(enabled bool) *RouteGroup {
+	r.serverTiming = &enabled
+	r.s.timingUsed = true
+	return r
+}
+
+// startTiming begins timing the request and sends the header if it's enabled for the matched route
+func (sn *Server) startTiming(r *Request) {
+	r.timing = &serverTiming{start: time.Now()}
+	r.BeforeWriteHeader(func() {
+		enabled := sn.serverTiming
+		if r.route != nil && r.route.options().serverTiming != nil {
+			enabled = *r.route.options().serverTiming
+		}
+
+		if enabled {
+			r.Header().Set(ServerTimingHeader, r.timing.header())
+		}
+	})
+}
+
+// AddTiming records a named duration for the Server-Timing header. The name should be a short
+// token such as db or cache, desc is optional.
+func (r *Request) AddTiming(name, desc string, d time.Duration) {
+	if r.timing == nil {
+		return
+	}
+
+	r.timing.add(name, desc, d)
+}
+
+// StartTiming starts timing a phase and returns the func that stops it and records its duration
+func (r *Request) StartTiming(name, desc string) func() {
+	start := time.Now()
+	return func() {
+		r.AddTiming(name, desc, time.Since(start))
+	}
+}
+
+// add appends a phase
+func (t *serverTiming) add(name, desc string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, timingPhase{name: name, desc: desc, dur: d})
+}
+
+// mark records the time since the last mark as a phase
+func (t *serverTiming) mark(name string, since time.Time) time.Time {
+	now := time.Now()
+	t.add(name, "", now.Sub(since))
+	return now
+}
+
+// header formats the phases as a Server-Timing header value. The handler phase covers the time
+// from the handler starting until the header is sent.
+func (t *serverTiming) header() string {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	write := func(p timingPhase) {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+
+		b.WriteString(timingToken(p.name))
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(p.dur)/float64(time.Millisecond), 'f', 3, 64))
+		if p.desc != "" {
+			b.WriteString(";desc=")
+			b.WriteString(strconv.Quote(p.desc))
+		}
+	}
+
+	for _, p := range t.phases {
+		write(p)
+	}
+
+	if !t.handler.IsZero() {
+		write(timingPhase{name: "handler", dur: now.Sub(t.handler)})
+	}
+
+	write(timingPhase{name: "total", dur: now.Sub(t.start)})
+	return b.String()
+}
+
+// timingToken replaces characters that aren't allowed in a header token
+func timingToken(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+			return r
+		}
+
+		return '_'
+	}, name)
+}
@@ -0,0 +1,48 @@
+package nova
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_EnableServerTiming(t *testing.T) {
+	s := New()
+	s.EnableServerTiming(true)
+
+	handler := func(r *Request) error {
+		r.AddTiming("db", "users query", 5*time.Millisecond)
+		return r.Send("ok")
+	}
+
+	s.Get("/timed", handler)
+	s.Group("/private").ServerTiming(false).Get("/untimed", handler)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/timed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	header := res.Header.Get(ServerTimingHeader)
+	for _, phase := range []string{"middleware;dur=", "router;dur=", `db;dur=5.000;desc="users query"`, "handler;dur=", "total;dur="} {
+		if !strings.Contains(header, phase) {
+			t.Errorf("expected %q in %q", phase, header)
+		}
+	}
+
+	res, err = http.Get(ts.URL + "/private/untimed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.Header.Get(ServerTimingHeader) != "" {
+		t.Error("group disabled server timing but the header was sent")
+	}
+}
@@ -0,0 +1,456 @@
+package nova
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// session defaults
+const (
+	DefaultSessionCookie          = "session"
+	DefaultSessionIdleTimeout     = 30 * time.Minute
+	DefaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+// ErrNoSessions is returned by Request.Session when the Sessions middleware isn't used
+var ErrNoSessions = errors.New("sessions aren't enabled")
+
+// ErrSessionDeleted is returned by a SessionStore when saving a session that has been deleted
+var ErrSessionDeleted = errors.New("session has been deleted")
+
+// ErrSessionHeaderSent is passed to SessionOptions.OnError when a session changes after the response
+// header was sent in a way that needs a new cookie, such as a new or regenerated session. The change isn't saved.
+var ErrSessionHeaderSent = errors.New("session changed after the response header was sent")
+
+// SessionData is the state of a session as it's kept by a SessionStore
+type SessionData struct {
+	ID       string                     `json:"id"`
+	Values   map[string]json.RawMessage `json:"values,omitempty"`
+	Flashes  []string                   `json:"flashes,omitempty"`
+	Created  time.Time                  `json:"created"`
+	LastSeen time.Time                  `json:"last_seen"`
+}
+
+// SessionStore keeps sessions between requests
+type SessionStore interface {
+	// Load returns the session for the value of the session cookie or nil if it doesn't exist
+	Load(ctx context.Context, cookie string) (*SessionData, error)
+
+	// Save stores the session for at least ttl and returns the value to send in the session cookie
+	Save(ctx context.Context, data *SessionData, ttl time.Duration) (string, error)
+
+	// Delete removes the session with the id. Until it would have expired, saving the id must fail with
+	// ErrSessionDeleted so a concurrent request can't restore a session replaced by Regenerate or Destroy.
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionOptions configures the Sessions middleware
+type SessionOptions struct {
+	// Store keeps the sessions, defaults to a new MemorySessionStore
+	Store SessionStore
+
+	// CookieName defaults to DefaultSessionCookie
+	CookieName string
+
+	// Cookie configures the session cookie, by default it's removed when the browser closes
+	Cookie CookieOptions
+
+	// IdleTimeout ends sessions that haven't been used for this long, defaults to DefaultSessionIdleTimeout
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout ends sessions this long after they were created however much they're used,
+	// defaults to DefaultSessionAbsoluteTimeout
+	AbsoluteTimeout time.Duration
+
+	// OnError is called with errors saving sessions, including ErrSessionHeaderSent, they're ignored if it's nil
+	OnError func(r *Request, err error)
+
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// Session holds values for a client across requests. It's loaded when Request.Session is first called
+// and saved before the response header is sent, changes made after that are saved once the handler returns.
+type Session struct {
+	mu   sync.Mutex
+	data *SessionData
+
+	// ids of the sessions replaced by Regenerate and Destroy, removed from the store on save
+	stale []string
+
+	isNew bool
+	dirty bool
+
+	// set when the session was destroyed or timed out so the cookie is removed unless a new session is saved
+	clearCookie bool
+	destroyed   bool
+}
+
+// sessionState is the per request session kept on the request
+type sessionState struct {
+	opts    *SessionOptions
+	session *Session
+	saved   bool
+
+	// cookie is the session cookie the client will have once the response is sent
+	cookie string
+}
+
+// sessionKey is the context key for the request's session state
+var sessionKey = NewKey[*sessionState]("session")
+
+// Sessions returns middleware that gives requests a session with Request.Session
+func Sessions(opts SessionOptions) func(*Request, func()) {
+	if opts.Store == nil {
+		opts.Store = NewMemorySessionStore()
+	}
+
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultSessionCookie
+	}
+
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultSessionIdleTimeout
+	}
+
+	if opts.AbsoluteTimeout <= 0 {
+		opts.AbsoluteTimeout = DefaultSessionAbsoluteTimeout
+	}
+
+	if opts.now == nil {
+		opts.now = time.Now
+	}
+
+	return func(req *Request, next func()) {
+		state := &sessionState{opts: &opts}
+		Set(req, sessionKey, state)
+
+		// save before the header is sent so the cookie can be set, and again once the request
+		// has been handled if nothing was written or the session changed after the header was sent
+		req.BeforeWriteHeader(func() { state.save(req, false) })
+		req.OnFinish(func() { state.save(req, req.HeaderWritten()) })
+
+		next()
+	}
+}
+
+// Session returns the request's session, loading it from the store the first time it's called.
+// A new session is started if the client has none or it has timed out.
+func (r *Request) Session() (*Session, error) {
+	state, ok := Get(r, sessionKey)
+	if !ok {
+		return nil, ErrNoSessions
+	}
+
+	if state.session != nil {
+		return state.session, nil
+	}
+
+	s, err := state.load(r)
+	if err != nil {
+		return nil, err
+	}
+
+	state.session = s
+	return s, nil
+}
+
+// load returns the client's session or a new one
+func (st *sessionState) load(r *Request) (*Session, error) {
+	now := st.opts.now()
+	cookie, err := r.CookieValue(st.opts.CookieName)
+	if err != nil {
+		return newSession(now)
+	}
+	st.cookie = cookie
+
+	data, err := st.opts.Store.Load(r.Context(), cookie)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't load session")
+	}
+
+	if data == nil {
+		return newSession(now)
+	}
+
+	if now.Sub(data.LastSeen) >= st.opts.IdleTimeout || now.Sub(data.Created) >= st.opts.AbsoluteTimeout {
+		s, err := newSession(now)
+		if err != nil {
+			return nil, err
+		}
+
+		s.stale = append(s.stale, data.ID)
+		s.clearCookie = true
+		return s, nil
+	}
+
+	return &Session{data: data}, nil
+}
+
+// save stores the session and sets the cookie if the session was used. Once saved it's only
+// stored again if it changed.
+func (st *sessionState) save(r *Request, headerSent bool) {
+	s := st.session
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st.saved && !s.dirty && len(s.stale) == 0 && !s.clearCookie {
+		return
+	}
+
+	st.saved = true
+	err := st.store(r, headerSent)
+
+	// the changes have been stored or reported
+	s.dirty, s.stale, s.clearCookie, s.destroyed = false, nil, false, false
+	if err != nil && st.opts.OnError != nil {
+		st.opts.OnError(r, err)
+	}
+}
+
+// store saves the session, once the header has been sent only changes that keep the client's cookie are saved
+func (st *sessionState) store(r *Request, headerSent bool) error {
+	s := st.session
+
+	// the client would keep the id that was replaced
+	if headerSent && s.dirty && !s.isNew && len(s.stale) > 0 {
+		return ErrSessionHeaderSent
+	}
+
+	ctx := r.Context()
+	for _, id := range s.stale {
+		if err := st.opts.Store.Delete(ctx, id); err != nil {
+			return errors.Wrap(err, "couldn't delete session")
+		}
+	}
+
+	// new sessions are only kept once something is stored in them
+	if s.isNew && !s.dirty {
+		if headerSent {
+			if s.destroyed {
+				return errors.Wrap(ErrSessionHeaderSent, "couldn't remove the session cookie")
+			}
+
+			return nil
+		}
+
+		if s.clearCookie {
+			r.DeleteCookie(st.opts.CookieName, st.opts.Cookie)
+			st.cookie = ""
+		}
+
+		return nil
+	}
+
+	// the client has no cookie to send the session back with
+	if headerSent && st.cookie == "" {
+		return ErrSessionHeaderSent
+	}
+
+	now := st.opts.now()
+	if s.data.Created.IsZero() {
+		s.data.Created = now
+	}
+	s.data.LastSeen = now
+
+	ttl := st.opts.IdleTimeout
+	if left := s.data.Created.Add(st.opts.AbsoluteTimeout).Sub(now); left < ttl {
+		ttl = left
+	}
+
+	if headerSent && !s.dirty {
+		// the session was loaded after the header was sent, extending its expiry is best effort
+		st.opts.Store.Save(ctx, s.data, ttl)
+		return nil
+	}
+
+	cookie, err := st.opts.Store.Save(ctx, s.data, ttl)
+	if err != nil {
+		return errors.Wrap(err, "couldn't save session")
+	}
+
+	if headerSent {
+		// stores that keep the session in the cookie need it to be sent again
+		if cookie != st.cookie {
+			return ErrSessionHeaderSent
+		}
+
+		return nil
+	}
+
+	r.SetCookie(st.opts.CookieName, cookie, st.opts.Cookie)
+	st.cookie = cookie
+	return nil
+}
+
+// newSession returns an empty session with a new id
+func newSession(now time.Time) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		data:  &SessionData{ID: id, Created: now, LastSeen: now},
+		isNew: true,
+	}, nil
+}
+
+// newSessionID returns a random id that can't be guessed
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "couldn't create session id")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ID returns the session id
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.ID
+}
+
+// IsNew reports whether the session was started by this request
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get decodes the value stored under key into v and reports whether it was set
+func (s *Session) Get(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, ok := s.data.Values[key]
+	if !ok {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, errors.Wrapf(err, "couldn't decode session value %s", key)
+	}
+
+	return true, nil
+}
+
+// GetString returns the string stored under key or "" if it isn't set
+func (s *Session) GetString(key string) string {
+	var v string
+	s.Get(key, &v)
+	return v
+}
+
+// Set stores v under key, it must be able to be encoded as JSON
+func (s *Session) Set(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't encode session value %s", key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Values == nil {
+		s.data.Values = map[string]json.RawMessage{}
+	}
+
+	s.data.Values[key] = raw
+	s.changed()
+	return nil
+}
+
+// Delete removes the value stored under key
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.changed()
+	}
+}
+
+// AddFlash adds a message that's kept until it's read with Flashes, usually on the next request
+func (s *Session) AddFlash(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Flashes = append(s.data.Flashes, msg)
+	s.changed()
+}
+
+// Flashes returns the flash messages and removes them from the session
+func (s *Session) Flashes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = nil
+		s.changed()
+	}
+
+	return flashes
+}
+
+// Regenerate gives the session a new id keeping its values. Call it when the user logs in
+// so an id set by an attacker before login can't be used.
+func (s *Session) Regenerate() error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isNew {
+		s.stale = append(s.stale, s.data.ID)
+	}
+
+	s.data.ID = id
+	s.changed()
+	return nil
+}
+
+// Destroy removes the session from the store and the client, call it when the user logs out.
+// Values set afterwards start a new session.
+func (s *Session) Destroy() error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isNew {
+		s.stale = append(s.stale, s.data.ID)
+	}
+
+	s.data = &SessionData{ID: id}
+	s.isNew = true
+	s.dirty = false
+	s.clearCookie = true
+	s.destroyed = true
+	return nil
+}
+
+// changed marks the session to be saved
+func (s *Session) changed() {
+	s.dirty = true
+}
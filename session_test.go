@@ -0,0 +1,347 @@
+package nova
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionServer returns a server with routes to use the session
+func sessionServer(opts SessionOptions) *Server {
+	s := New()
+	s.Use(Sessions(opts))
+	s.Get("/set", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		sess.AddFlash("saved")
+		return sess.Set("user", req.QueryParam("user"))
+	})
+	s.Get("/get", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		flashes := sess.Flashes()
+		return req.Send(sess.GetString("user") + " " + strings.Join(flashes, ","))
+	})
+	s.Get("/login", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		return sess.Regenerate()
+	})
+	s.Get("/logout", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		return sess.Destroy()
+	})
+	s.Get("/late", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		req.Send("ok")
+		return sess.Set("user", req.QueryParam("user"))
+	})
+	s.Get("/none", func(req *Request) error {
+		return req.Send("ok")
+	})
+
+	return s
+}
+
+// doSession makes a request with the session cookie returning the response and the new cookie if one was set
+func doSession(s *Server, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultSessionCookie {
+			return w, c
+		}
+	}
+
+	return w, cookie
+}
+
+func TestSessions(t *testing.T) {
+	codec, _ := NewCookieEncrypter(bytes.Repeat([]byte{3}, 32))
+	files, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   files,
+		"cookie": NewCookieSessionStore(codec),
+	} {
+		s := sessionServer(SessionOptions{Store: store})
+
+		if w, c := doSession(s, "/none", nil); c != nil || w.Body.String() != "ok" {
+			t.Errorf("%s expected no session for routes that don't use it got %v", name, c)
+		}
+
+		if _, c := doSession(s, "/get", nil); c != nil {
+			t.Errorf("%s expected unchanged new sessions not to be saved got %v", name, c)
+		}
+
+		_, cookie := doSession(s, "/set?user=ann", nil)
+		if cookie == nil || !cookie.HttpOnly || !cookie.Secure {
+			t.Fatalf("%s expected a secure session cookie got %v", name, cookie)
+		}
+
+		w, cookie := doSession(s, "/get", cookie)
+		if w.Body.String() != "ann saved" {
+			t.Errorf("%s expected the session values and flash got %q", name, w.Body.String())
+		}
+
+		w, cookie = doSession(s, "/get", cookie)
+		if w.Body.String() != "ann " {
+			t.Errorf("%s expected the flash to be removed once read got %q", name, w.Body.String())
+		}
+
+		old := cookie
+		_, cookie = doSession(s, "/login", cookie)
+		if cookie.Value == old.Value {
+			t.Errorf("%s expected login to change the session id", name)
+		}
+
+		if w, _ := doSession(s, "/get", cookie); w.Body.String() != "ann " {
+			t.Errorf("%s expected regenerate to keep the values got %q", name, w.Body.String())
+		}
+
+		if name != "cookie" {
+			if w, _ := doSession(s, "/get", old); w.Body.String() != " " {
+				t.Errorf("%s expected the old session id to be removed got %q", name, w.Body.String())
+			}
+		}
+
+		_, deleted := doSession(s, "/logout", cookie)
+		if deleted.MaxAge != -1 {
+			t.Errorf("%s expected logout to delete the cookie got %v", name, deleted)
+		}
+
+		if name != "cookie" {
+			if w, _ := doSession(s, "/get", cookie); w.Body.String() != " " {
+				t.Errorf("%s expected the destroyed session to be removed got %q", name, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestSessions_Timeouts(t *testing.T) {
+	now := time.Now()
+	opts := SessionOptions{
+		IdleTimeout:     10 * time.Minute,
+		AbsoluteTimeout: time.Hour,
+		now:             func() time.Time { return now },
+	}
+	s := sessionServer(opts)
+
+	_, cookie := doSession(s, "/set?user=ann", nil)
+
+	// used every 9 minutes so it never idles but it still ends after an hour
+	for i := 0; i < 6; i++ {
+		now = now.Add(9 * time.Minute)
+		w, c := doSession(s, "/get", cookie)
+		if w.Body.String() == " " {
+			t.Fatalf("expected the session to be kept after %d minutes", (i+1)*9)
+		}
+		cookie = c
+	}
+
+	now = now.Add(9 * time.Minute)
+	w, cleared := doSession(s, "/get", cookie)
+	if w.Body.String() != " " {
+		t.Errorf("expected the absolute timeout to end the session got %q", w.Body.String())
+	}
+
+	if cleared.MaxAge != -1 {
+		t.Errorf("expected the timed out session's cookie to be removed got %v", cleared)
+	}
+
+	_, cookie = doSession(s, "/set?user=bob", nil)
+	now = now.Add(10 * time.Minute)
+	if w, _ := doSession(s, "/get", cookie); w.Body.String() != " " {
+		t.Errorf("expected the idle timeout to end the session got %q", w.Body.String())
+	}
+}
+
+func TestSessions_NotEnabled(t *testing.T) {
+	s := New()
+	s.Get("/", func(req *Request) error {
+		_, err := req.Session()
+		if err != ErrNoSessions {
+			t.Errorf("expected ErrNoSessions got %v", err)
+		}
+
+		return nil
+	})
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileSessionStore(dir)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	secret := filepath.Join(dir, "secret.session")
+	os.WriteFile(secret, []byte(`{"id":"secret"}`), 0600)
+	os.Chtimes(secret, now, now.Add(time.Hour))
+	if data, _ := store.Load(ctx, "../"+filepath.Base(dir)+"/secret"); data != nil {
+		t.Error("expected ids that leave the directory to be rejected")
+	}
+
+	if _, err := store.Save(ctx, &SessionData{ID: "a", Created: now}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := store.Load(ctx, "a"); err != nil || data == nil || data.ID != "a" {
+		t.Errorf("expected the saved session got %v %v", data, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if data, _ := store.Load(ctx, "a"); data != nil {
+		t.Error("expected the session to expire")
+	}
+
+	store.Save(ctx, &SessionData{ID: "b"}, time.Minute)
+	if _, err := os.Stat(filepath.Join(dir, "a.session")); !os.IsNotExist(err) {
+		t.Errorf("expected expired sessions to be swept got %v", err)
+	}
+}
+
+func TestSessionStores_RefuseDeleted(t *testing.T) {
+	files, _ := NewFileSessionStore(t.TempDir())
+	ctx := context.Background()
+
+	for name, store := range map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   files,
+	} {
+		data := &SessionData{ID: "old", Created: time.Now()}
+		if _, err := store.Save(ctx, data, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		// a request regenerates the session while another still has the old id
+		if err := store.Delete(ctx, "old"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Save(ctx, data, time.Minute); err != ErrSessionDeleted {
+			t.Errorf("%s expected saving a deleted session to fail got %v", name, err)
+		}
+
+		if data, _ := store.Load(ctx, "old"); data != nil {
+			t.Errorf("%s expected the deleted session not to be loaded", name)
+		}
+	}
+}
+
+func TestSessions_ConcurrentRegenerate(t *testing.T) {
+	var saveErr error
+	store := NewMemorySessionStore()
+	s := sessionServer(SessionOptions{Store: store, OnError: func(r *Request, err error) { saveErr = err }})
+	_, cookie := doSession(s, "/set?user=ann", nil)
+
+	// a slow request loads the session before the login regenerates it and saves after
+	slow := New()
+	slow.Use(Sessions(SessionOptions{Store: store, OnError: func(r *Request, err error) { saveErr = err }}))
+	loaded := make(chan struct{})
+	loggedIn := make(chan struct{})
+	slow.Get("/slow", func(req *Request) error {
+		sess, err := req.Session()
+		if err != nil {
+			return err
+		}
+
+		close(loaded)
+		<-loggedIn
+		return sess.Set("cart", 1)
+	})
+
+	done := make(chan *http.Cookie)
+	go func() {
+		_, c := doSession(slow, "/slow", cookie)
+		done <- c
+	}()
+
+	<-loaded
+	_, regenerated := doSession(s, "/login", cookie)
+	close(loggedIn)
+
+	if c := <-done; c != cookie {
+		t.Errorf("expected the slow request not to set the old session again got %v", c)
+	}
+
+	if !errors.Is(saveErr, ErrSessionDeleted) {
+		t.Errorf("expected the slow request's save to be refused got %v", saveErr)
+	}
+
+	if w, _ := doSession(s, "/get", cookie); w.Body.String() != " " {
+		t.Errorf("expected the old session id to stay removed got %q", w.Body.String())
+	}
+
+	if w, _ := doSession(s, "/get", regenerated); w.Body.String() != "ann saved" {
+		t.Errorf("expected the regenerated session to be kept got %q", w.Body.String())
+	}
+}
+
+func TestSessions_ChangedAfterHeader(t *testing.T) {
+	codec, _ := NewCookieEncrypter(bytes.Repeat([]byte{3}, 32))
+	for name, store := range map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"cookie": NewCookieSessionStore(codec),
+	} {
+		var saveErr error
+		s := sessionServer(SessionOptions{Store: store, OnError: func(r *Request, err error) { saveErr = err }})
+
+		// a new session needs a cookie that can no longer be sent
+		doSession(s, "/late?user=ann", nil)
+		if !errors.Is(saveErr, ErrSessionHeaderSent) {
+			t.Errorf("%s expected a new session changed after the header to be reported got %v", name, saveErr)
+		}
+
+		saveErr = nil
+		_, cookie := doSession(s, "/set?user=ann", nil)
+		doSession(s, "/late?user=bob", cookie)
+		w, _ := doSession(s, "/get", cookie)
+
+		switch name {
+		case "memory":
+			if saveErr != nil || w.Body.String() != "bob saved" {
+				t.Errorf("expected the change after the header to be saved got %q %v", w.Body.String(), saveErr)
+			}
+		case "cookie":
+			if !errors.Is(saveErr, ErrSessionHeaderSent) || w.Body.String() != "ann saved" {
+				t.Errorf("expected the change to the cookie to be reported got %q %v", w.Body.String(), saveErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package nova
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sessionSweepInterval is the least time between removing expired sessions
+const sessionSweepInterval = time.Minute
+
+// MemorySessionStore keeps sessions in memory, they're lost when the process exits
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memorySession is an encoded session and when it expires, deleted sessions are kept without their data
+// until they expire so they can't be saved again
+type memorySession struct {
+	data    []byte
+	expires time.Time
+	deleted bool
+}
+
+// NewMemorySessionStore returns an empty in memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]memorySession{}, now: time.Now}
+}
+
+// Load implements SessionStore
+func (s *MemorySessionStore) Load(_ context.Context, id string) (*SessionData, error) {
+	s.mu.Lock()
+	m, ok := s.sessions[id]
+	s.mu.Unlock()
+
+	if !ok || m.deleted || !s.now().Before(m.expires) {
+		return nil, nil
+	}
+
+	return decodeSession(m.data)
+}
+
+// Save implements SessionStore
+func (s *MemorySessionStore) Save(_ context.Context, data *SessionData, ttl time.Duration) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't encode session")
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	if m, ok := s.sessions[data.ID]; ok && m.deleted && now.Before(m.expires) {
+		return "", ErrSessionDeleted
+	}
+
+	s.sessions[data.ID] = memorySession{data: b, expires: now.Add(ttl)}
+	return data.ID, nil
+}
+
+// Delete implements SessionStore
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.sessions[id]; ok {
+		s.sessions[id] = memorySession{expires: m.expires, deleted: true}
+	}
+
+	return nil
+}
+
+// sweep removes expired sessions at most once every sessionSweepInterval
+func (s *MemorySessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sessionSweepInterval {
+		return
+	}
+
+	s.lastSweep = now
+	for id, m := range s.sessions {
+		if !now.Before(m.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// FileSessionStore keeps each session in a file in a directory so they survive restarts.
+// Deleted sessions are renamed rather than removed until they expire so they can't be saved again.
+type FileSessionStore struct {
+	dir string
+
+	// held while saving and deleting so a save can't restore a session being deleted
+	mu        sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// session file extensions
+const (
+	sessionFileExt = ".session"
+	deletedFileExt = ".deleted"
+)
+
+// NewFileSessionStore returns a store keeping sessions in dir, creating it if it doesn't exist
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "couldn't create session directory")
+	}
+
+	return &FileSessionStore{dir: dir, now: time.Now}, nil
+}
+
+// path returns the file for a session or "" if the id could escape the directory
+func (s *FileSessionStore) path(id string, ext string) string {
+	if id == "" || strings.IndexFunc(id, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_')
+	}) >= 0 {
+		return ""
+	}
+
+	return filepath.Join(s.dir, id+ext)
+}
+
+// Load implements SessionStore
+func (s *FileSessionStore) Load(_ context.Context, id string) (*SessionData, error) {
+	path := s.path(id, sessionFileExt)
+	if path == "" {
+		return nil, nil
+	}
+
+	// the file's modification time is set to when the session expires
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read session")
+	}
+
+	if !s.now().Before(info.ModTime()) {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read session")
+	}
+
+	return decodeSession(b)
+}
+
+// Save implements SessionStore
+func (s *FileSessionStore) Save(_ context.Context, data *SessionData, ttl time.Duration) (string, error) {
+	path := s.path(data.ID, sessionFileExt)
+	if path == "" {
+		return "", errors.Errorf("invalid session id %q", data.ID)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't encode session")
+	}
+
+	// write to a temporary file and rename it so a session is never read half written
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't save session")
+	}
+
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	now := s.now()
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), now, now.Add(ttl))
+	}
+
+	if err == nil {
+		err = s.replace(tmp.Name(), path, s.path(data.ID, deletedFileExt), now)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		if err == ErrSessionDeleted {
+			return "", err
+		}
+
+		return "", errors.Wrap(err, "couldn't save session")
+	}
+
+	s.sweep(now)
+	return data.ID, nil
+}
+
+// replace renames the new session file into place unless the session has been deleted
+func (s *FileSessionStore) replace(tmp, path, deleted string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if info, err := os.Stat(deleted); err == nil && now.Before(info.ModTime()) {
+		return ErrSessionDeleted
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Delete implements SessionStore
+func (s *FileSessionStore) Delete(_ context.Context, id string) error {
+	path := s.path(id, sessionFileExt)
+	if path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the renamed file keeps its modification time so it's swept when the session would have expired
+	if err := os.Rename(path, s.path(id, deletedFileExt)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "couldn't delete session")
+	}
+
+	return nil
+}
+
+// sweep removes expired session files at most once every sessionSweepInterval
+func (s *FileSessionStore) sweep(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < sessionSweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), sessionFileExt) && !strings.HasSuffix(e.Name(), deletedFileExt) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err == nil && !now.Before(info.ModTime()) {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+	}
+}
+
+// sessionCookieName binds cookie store values to sessions so other cookies using the codec can't be used
+const sessionCookieName = "nova-session"
+
+// cookieSessionStore keeps the whole session in the cookie
+type cookieSessionStore struct {
+	codec CookieCodec
+}
+
+// NewCookieSessionStore returns a store that keeps sessions in the cookie itself, encoded with codec.
+// Use a codec from NewCookieEncrypter so clients can't read their sessions. Sessions are limited
+// to about 4KB and a session removed with Regenerate or Destroy can't be revoked on the server,
+// a copy of the old cookie is valid until the session times out.
+func NewCookieSessionStore(codec CookieCodec) SessionStore {
+	return &cookieSessionStore{codec: codec}
+}
+
+// Load implements SessionStore
+func (s *cookieSessionStore) Load(_ context.Context, cookie string) (*SessionData, error) {
+	v, err := s.codec.Decode(sessionCookieName, cookie)
+	if err != nil {
+		// a tampered cookie or one encoded with a retired key is treated as no session
+		return nil, nil
+	}
+
+	data, err := decodeSession([]byte(v))
+	if err != nil {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// Save implements SessionStore
+func (s *cookieSessionStore) Save(_ context.Context, data *SessionData, _ time.Duration) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't encode session")
+	}
+
+	return s.codec.Encode(sessionCookieName, string(b))
+}
+
+// Delete implements SessionStore, the cookie is removed by the middleware
+func (s *cookieSessionStore) Delete(context.Context, string) error {
+	return nil
+}
+
+// decodeSession decodes a session encoded by a store
+func decodeSession(b []byte) (*SessionData, error) {
+	data := &SessionData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode session")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,220 @@
+package nova
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCertCheckInterval is how often certificate files are checked for changes when no interval is set
+const DefaultCertCheckInterval = time.Minute
+
+// TLSOptions configures TLS for Run. The certificate, key and client CA files are reloaded when they
+// change so certificates can be rotated without restarting, existing connections keep their certificate.
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM encoded certificate chain and private key
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is a PEM bundle of CAs client certificates are verified against
+	ClientCAFile string
+
+	// ClientAuth is the client certificate policy, defaults to tls.RequireAndVerifyClientCert
+	// when ClientCAFile is set
+	ClientAuth tls.ClientAuthType
+
+	// CheckInterval is how often the files are checked for changes, defaults to DefaultCertCheckInterval
+	CheckInterval time.Duration
+
+	// Config is used as the base configuration when set, its certificates and client CAs are replaced
+	Config *tls.Config
+
+	// OnReloadError is called when changed files can't be loaded, the previous certificates are kept
+	OnReloadError func(err error)
+}
+
+// certReloader serves the certificates loaded from disk, loading them again when the files change
+type certReloader struct {
+	opts TLSOptions
+	base *tls.Config
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertReloader loads the certificates, failing if they can't be loaded
+func newCertReloader(opts TLSOptions) (*certReloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("tls needs a certificate and key file")
+	}
+
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = DefaultCertCheckInterval
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.Config != nil {
+		base = opts.Config.Clone()
+	}
+
+	if len(base.NextProtos) == 0 {
+		base.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	base.ClientAuth = opts.ClientAuth
+	if opts.ClientCAFile != "" && opts.ClientAuth == tls.NoClientCert {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	c := &certReloader{opts: opts, base: base}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// config returns the tls config serving the reloaded certificates
+func (c *certReloader) config() *tls.Config {
+	cfg := c.base.Clone()
+	cfg.GetConfigForClient = c.configForClient
+	return cfg
+}
+
+// configForClient returns the config for a new connection with the current certificate and client CAs
+func (c *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.reloadIfChanged()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cfg := c.base.Clone()
+	cfg.Certificates = []tls.Certificate{*c.cert}
+	cfg.ClientCAs = c.pool
+	return cfg, nil
+}
+
+// reloadIfChanged loads the files again if the check interval has passed and one of them has changed
+func (c *certReloader) reloadIfChanged() {
+	c.mu.Lock()
+	if time.Since(c.checked) < c.opts.CheckInterval {
+		c.mu.Unlock()
+		return
+	}
+
+	c.checked = time.Now()
+	modTime := c.modTime
+	c.mu.Unlock()
+
+	latest, err := c.latestModTime()
+	if err == nil && !latest.After(modTime) {
+		return
+	}
+
+	if err == nil {
+		err = c.load()
+	}
+
+	if err != nil && c.opts.OnReloadError != nil {
+		c.opts.OnReloadError(err)
+	}
+}
+
+// latestModTime returns the most recent modification time of the files
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{c.opts.CertFile, c.opts.KeyFile, c.opts.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, errors.Wrap(err, "couldn't stat tls file")
+		}
+
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// load reads the certificate, key and client CAs
+func (c *certReloader) load() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.opts.CertFile, c.opts.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "couldn't load certificate")
+	}
+
+	var pool *x509.CertPool
+	if c.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.opts.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "couldn't read client CA file")
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("client CA file has no certificates")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.pool = pool
+	c.modTime = modTime
+	c.checked = time.Now()
+	return nil
+}
+
+// ClientIdentity is the identity from a verified client certificate
+type ClientIdentity struct {
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	IPAddresses    []net.IP
+
+	// Certificate is the verified leaf certificate
+	Certificate *x509.Certificate
+}
+
+// ClientIdentity returns the identity of the client certificate if one was sent and verified
+func (r *Request) ClientIdentity() (ClientIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	id := ClientIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		Certificate:    cert,
+	}
+
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+
+	return id, true
+}
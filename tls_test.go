@@ -0,0 +1,186 @@
+package nova
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert creates a certificate signed by parent, or self signed if parent is nil
+func testCert(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func writePEM(t *testing.T, path string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	out := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if key != nil {
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.WriteFile(path+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600)
+	}
+
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	serverTmpl := func(serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "server"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+
+	certFile := filepath.Join(dir, "server.pem")
+	writePEM(t, filepath.Join(dir, "ca.pem"), ca, nil)
+	cert, key := testCert(t, serverTmpl(2), ca, caKey)
+	writePEM(t, certFile, cert, key)
+
+	client, clientKey := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "billing", Organization: []string{"payments"}},
+		DNSNames:     []string{"billing.internal"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New()
+	s.Get("/whoami", func(r *Request) error {
+		id, ok := r.ClientIdentity()
+		if !ok {
+			return r.Send("anonymous")
+		}
+
+		return r.Send(id.CommonName + " " + id.DNSNames[0])
+	})
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- s.Run(RunOptions{Listener: ln, TLS: &TLSOptions{
+			CertFile:      certFile,
+			KeyFile:       certFile + ".key",
+			ClientCAFile:  filepath.Join(dir, "ca.pem"),
+			CheckInterval: time.Millisecond,
+		}})
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	get := func(certs []tls.Certificate) (string, *big.Int, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+
+		res, err := c.Get("https://" + ln.Addr().String() + "/whoami")
+		if err != nil {
+			return "", nil, err
+		}
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(res.Body)
+		return string(b), res.TLS.PeerCertificates[0].SerialNumber, nil
+	}
+
+	clientCert := []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}}
+
+	var body string
+	var serial *big.Int
+	for i := 0; i < 100; i++ {
+		body, serial, err = get(clientCert)
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "billing billing.internal" || serial.Int64() != 2 {
+		t.Errorf("expected client identity from serial 2 got %q from %s", body, serial)
+	}
+
+	if _, _, err := get(nil); err == nil {
+		t.Error("expected a client without a certificate to be rejected")
+	}
+
+	// rotate the server certificate
+	cert, key = testCert(t, serverTmpl(4), ca, caKey)
+	writePEM(t, certFile, cert, key)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, serial, err = get(clientCert); err != nil || serial.Int64() != 4 {
+		t.Errorf("expected reloaded certificate with serial 4 got %v %v", serial, err)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	<-ran
+}
+
+func TestRunTLSMissingCert(t *testing.T) {
+	s := New()
+	err := s.Run(RunOptions{Addr: "127.0.0.1:0", TLS: &TLSOptions{CertFile: "missing.pem", KeyFile: "missing.key"}})
+	if err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+}
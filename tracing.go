@@ -0,0 +1,453 @@
+package nova
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// W3C Trace Context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// span attribute keys
+const (
+	AttrHTTPMethod = "http.request.method"
+	AttrHTTPRoute  = "http.route"
+	AttrURLPath    = "url.path"
+	AttrHTTPStatus = "http.response.status_code"
+	AttrRequestID  = "request.id"
+	AttrError      = "error"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the lowercase hex encoding of the id
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether the id isn't all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding of the id
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether the id isn't all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// FlagSampled is the trace flag set when the trace is recorded
+const FlagSampled = 0x01
+
+// SpanContext is the part of a span that's propagated between services
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+
+	// Remote is true when the context was received from another service
+	Remote bool
+}
+
+// IsValid reports whether the context has a trace and span id
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled reports whether the sampled flag is set
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats the context as a traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses and validates a traceparent header value
+func ParseTraceparent(h string) (SpanContext, error) {
+	var sc SpanContext
+	h = strings.TrimSpace(h)
+
+	// version 00 has exactly four fields, later versions may append more
+	if len(h) < 55 || h[2] != '-' || h[35] != '-' || h[52] != '-' {
+		return sc, errors.New("malformed traceparent")
+	}
+
+	version, err := decodeLowerHex(h[:2], 1)
+	if err != nil || version[0] == 0xff {
+		return sc, errors.New("invalid traceparent version")
+	}
+
+	if version[0] == 0 && len(h) != 55 {
+		return sc, errors.New("malformed traceparent")
+	}
+
+	if len(h) > 55 && h[55] != '-' {
+		return sc, errors.New("malformed traceparent")
+	}
+
+	traceID, err := decodeLowerHex(h[3:35], 16)
+	if err != nil {
+		return sc, errors.Wrap(err, "invalid trace id")
+	}
+
+	spanID, err := decodeLowerHex(h[36:52], 8)
+	if err != nil {
+		return sc, errors.Wrap(err, "invalid parent id")
+	}
+
+	flags, err := decodeLowerHex(h[53:55], 1)
+	if err != nil {
+		return sc, errors.Wrap(err, "invalid trace flags")
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	sc.Remote = true
+
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("traceparent has an all zero id")
+	}
+
+	return sc, nil
+}
+
+// decodeLowerHex decodes s which must be n bytes of lowercase hex
+func decodeLowerHex(s string, n int) ([]byte, error) {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return nil, errors.New("expected lowercase hex")
+	}
+
+	return hex.DecodeString(s)
+}
+
+// validTracestate reports whether the tracestate value is within the W3C limits
+func validTracestate(ts string) bool {
+	if len(ts) > 512 {
+		return false
+	}
+
+	members := 0
+	for _, m := range strings.Split(ts, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+
+		members++
+		eq := strings.IndexByte(m, '=')
+		if eq < 1 || eq == len(m)-1 || members > 32 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SpanStatus is the outcome of a span
+type SpanStatus int
+
+// span statuses
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusOK
+	SpanStatusError
+)
+
+// Span is a timed operation within a trace. Its methods are safe to call on a nil Span.
+type Span struct {
+	Name   string
+	Parent SpanContext
+	Start  time.Time
+	End    time.Time
+	Status SpanStatus
+
+	mu         sync.Mutex
+	sc         SpanContext
+	attributes map[string]interface{}
+	err        error
+	tracer     Tracer
+	ended      bool
+}
+
+// NewSpan returns a span started now for use by Tracer implementations.
+// The tracer's End method is called when the span is finished.
+func NewSpan(t Tracer, name string, sc, parent SpanContext) *Span {
+	return &Span{
+		Name:   name,
+		Parent: parent,
+		Start:  time.Now(),
+		sc:     sc,
+		tracer: t,
+	}
+}
+
+// SpanContext returns the span's propagated context
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.sc
+}
+
+// SetAttribute records a key value pair on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = map[string]interface{}{}
+	}
+
+	s.attributes[key] = value
+}
+
+// Attributes returns a copy of the span's attributes
+func (s *Span) Attributes() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attrs[k] = v
+	}
+
+	return attrs
+}
+
+// SetError marks the span as failed with err
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.Status = SpanStatusError
+	s.mu.Unlock()
+
+	s.SetAttribute(AttrError, err.Error())
+}
+
+// Err returns the error recorded on the span
+func (s *Span) Err() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Finish ends the span and hands it to the tracer, only the first call has an effect
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.End(s)
+}
+
+// Inject sets the traceparent and tracestate headers so the trace continues in an outgoing request
+func (s *Span) Inject(h http.Header) {
+	if s == nil || !s.sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceparentHeader, s.sc.Traceparent())
+	if s.sc.TraceState != "" {
+		h.Set(TracestateHeader, s.sc.TraceState)
+	}
+}
+
+// Tracer creates spans and receives them once they've finished
+type Tracer interface {
+	// Start returns a new span that's a child of parent, or the root of a new trace if parent isn't valid
+	Start(parent SpanContext, name string) *Span
+
+	// End is called once the span has finished
+	End(span *Span)
+}
+
+// SpanExporter receives sampled spans once they've finished
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// tracer is the default Tracer that creates W3C compatible ids and exports sampled spans
+type tracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer returns a Tracer that sends finished sampled spans to exporter
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+// Start implements Tracer
+func (t *tracer) Start(parent SpanContext, name string) *Span {
+	var sc SpanContext
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		for !sc.TraceID.IsValid() {
+			rand.Read(sc.TraceID[:])
+		}
+
+		sc.Flags = FlagSampled
+	}
+
+	for !sc.SpanID.IsValid() {
+		rand.Read(sc.SpanID[:])
+	}
+
+	return NewSpan(t, name, sc, parent)
+}
+
+// End implements Tracer
+func (t *tracer) End(span *Span) {
+	if t.exporter != nil && span.sc.Sampled() {
+		t.exporter.ExportSpan(span)
+	}
+}
+
+// InMemoryExporter keeps finished spans in memory for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpan implements SpanExporter
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes all exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// spanKey is the context key for the current span
+var spanKey = NewKey[*Span]("span")
+
+// ContextWithSpan returns a copy of ctx holding span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// SpanFromContext returns the span in ctx or nil if there isn't one
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// StartSpan starts a child of the span in ctx and returns a context holding it.
+// If ctx has no span the returned span is nil, which is safe to use.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := parent.tracer.Start(parent.sc, name)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Span returns the server span for the request or nil if tracing isn't enabled
+func (r *Request) Span() *Span {
+	return SpanFromContext(r.Context())
+}
+
+// EnableTracing continues incoming W3C traces, or starts new ones, with a server span
+// for every request named after the matched route
+func (sn *Server) EnableTracing(t Tracer) {
+	sn.tracer = t
+}
+
+// startServerSpan starts the span for the request and returns the func that finishes it
+func (sn *Server) startServerSpan(r *Request) func() {
+	var parent SpanContext
+	if sc, err := ParseTraceparent(r.Request.Header.Get(TraceparentHeader)); err == nil {
+		parent = sc
+		if ts := strings.Join(r.Request.Header.Values(TracestateHeader), ","); validTracestate(ts) {
+			parent.TraceState = ts
+		}
+	}
+
+	span := sn.tracer.Start(parent, r.GetMethod())
+	span.SetAttribute(AttrHTTPMethod, r.GetMethod())
+	span.SetAttribute(AttrURLPath, r.URL.Path)
+	Set(r, spanKey, span)
+
+	return func() {
+		if route := r.RoutePattern(); route != "" {
+			span.Name = r.GetMethod() + " " + route
+			span.SetAttribute(AttrHTTPRoute, route)
+		}
+
+		if id := r.RequestID(); id != "" {
+			span.SetAttribute(AttrRequestID, id)
+		}
+
+		span.SetAttribute(AttrHTTPStatus, r.ResponseCode)
+		if r.ResponseCode >= 500 {
+			span.mu.Lock()
+			span.Status = SpanStatusError
+			span.mu.Unlock()
+		}
+
+		span.Finish()
+	}
+}
@@ -0,0 +1,92 @@
+package nova
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled() {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+
+	if sc.Traceparent() != valid {
+		t.Errorf("expected %s got %s", valid, sc.Traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, h := range invalid {
+		if _, err := ParseTraceparent(h); err == nil {
+			t.Errorf("expected %q to be invalid", h)
+		}
+	}
+
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Errorf("future versions may have extra fields: %s", err)
+	}
+}
+
+func TestServer_EnableTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	s := New()
+	s.EnableTracing(NewTracer(exporter))
+	s.Get("/users/:id", func(r *Request) error {
+		_, child := StartSpan(r.Context(), "db")
+		child.Finish()
+		return errors.New("lookup failed")
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/users/1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TracestateHeader, "vendor=value")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans got %d", len(spans))
+	}
+
+	child, server := spans[0], spans[1]
+	if server.Name != "GET /users/:id" || server.Status != SpanStatusError || server.Err() == nil {
+		t.Errorf("unexpected server span %s %v %v", server.Name, server.Status, server.Err())
+	}
+
+	if server.SpanContext().TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.SpanID.String() != "00f067aa0ba902b7" {
+		t.Error("server span didn't continue the incoming trace")
+	}
+
+	if server.SpanContext().TraceState != "vendor=value" {
+		t.Errorf("expected tracestate to be kept got %q", server.SpanContext().TraceState)
+	}
+
+	if child.Parent.SpanID != server.SpanContext().SpanID {
+		t.Error("child span isn't a child of the server span")
+	}
+
+	if server.Attributes()[AttrHTTPRoute] != "/users/:id" {
+		t.Errorf("expected route attribute got %v", server.Attributes()[AttrHTTPRoute])
+	}
+}
@@ -0,0 +1,281 @@
+package nova
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUploadMaxFieldSize is the total size of non-file fields kept in memory when no MaxFieldSize is configured
+const DefaultUploadMaxFieldSize = 1 << 20
+
+var (
+	// ErrTooManyFiles is returned when a multipart request has more files than allowed
+	ErrTooManyFiles = errors.New("too many files in upload")
+
+	// ErrUnsupportedFileType is returned when an uploaded file's sniffed content type isn't allowed
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+)
+
+// UploadOptions configures how multipart uploads are saved
+type UploadOptions struct {
+	// Dir is where uploaded files are saved and kept. If empty files are written to
+	// temp files that are removed once the request has been handled.
+	Dir string
+
+	// MaxFileSize is the maximum size in bytes of a single file, 0 is unlimited
+	MaxFileSize int64
+
+	// MaxFiles is the maximum number of files in the upload, 0 is unlimited
+	MaxFiles int
+
+	// MaxFieldSize is the total size in bytes of all non-file fields, 0 uses DefaultUploadMaxFieldSize
+	MaxFieldSize int64
+
+	// AllowedTypes is the list of media types detected from the file contents that are accepted,
+	// entries ending in a slash match every subtype. Empty allows every type.
+	AllowedTypes []string
+}
+
+// UploadedFile is a file from a multipart request that has been saved to disk
+type UploadedFile struct {
+	// FieldName is the form field the file was sent in
+	FieldName string
+
+	// Filename is the name the client gave the file, it shouldn't be trusted as a path
+	Filename string
+
+	// ContentType is detected from the file contents
+	ContentType string
+
+	// Size of the file in bytes
+	Size int64
+
+	// Path is where the file was saved
+	Path string
+
+	// temp files are removed when the request finishes
+	temp bool
+}
+
+// Open opens the saved file for reading
+func (f *UploadedFile) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+// SaveTo moves the file to dst so it isn't removed when the request finishes
+func (f *UploadedFile) SaveTo(dst string) error {
+	if err := os.Rename(f.Path, dst); err == nil {
+		f.Path = dst
+		f.temp = false
+		return nil
+	}
+
+	// rename fails across file systems so fall back to copying
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(f.Path)
+	f.Path = dst
+	f.temp = false
+	return nil
+}
+
+// Upload holds the fields and files parsed from a multipart request
+type Upload struct {
+	Values url.Values
+	Files  []*UploadedFile
+}
+
+// File returns the first file sent in the field or nil if there isn't one
+func (u *Upload) File(field string) *UploadedFile {
+	for _, f := range u.Files {
+		if f.FieldName == field {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// EachPart streams the parts of a multipart request to fn without buffering them.
+// Each part is closed after fn returns and iteration stops at the first error.
+func (r *Request) EachPart(fn func(part *multipart.Part) error) error {
+	mr, err := r.Request.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// SaveUploads streams a multipart request to disk enforcing the limits in opts. Files are
+// written as they're read so they're never held in memory. If any limit is exceeded the
+// files already written are removed and the error is returned.
+func (r *Request) SaveUploads(opts UploadOptions) (*Upload, error) {
+	maxFieldSize := opts.MaxFieldSize
+	if maxFieldSize <= 0 {
+		maxFieldSize = DefaultUploadMaxFieldSize
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	upload := &Upload{Values: url.Values{}}
+	fieldSize := int64(0)
+
+	err := r.EachPart(func(part *multipart.Part) error {
+		// non-file fields are kept in memory
+		if part.FileName() == "" {
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, io.LimitReader(part, maxFieldSize-fieldSize+1))
+			if err != nil {
+				return err
+			}
+
+			fieldSize += n
+			if fieldSize > maxFieldSize {
+				return &PayloadTooLargeError{Limit: maxFieldSize}
+			}
+
+			upload.Values.Add(part.FormName(), buf.String())
+			return nil
+		}
+
+		if opts.MaxFiles > 0 && len(upload.Files) >= opts.MaxFiles {
+			return errors.Wrapf(ErrTooManyFiles, "limit is %d", opts.MaxFiles)
+		}
+
+		f, err := saveFile(part, dir, opts)
+		if f != nil {
+			upload.Files = append(upload.Files, f)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		for _, f := range upload.Files {
+			os.Remove(f.Path)
+		}
+
+		return nil, err
+	}
+
+	// temp files don't outlive the request unless they were moved with SaveTo
+	if opts.Dir == "" {
+		r.OnFinish(func() {
+			for _, f := range upload.Files {
+				if f.temp {
+					os.Remove(f.Path)
+				}
+			}
+		})
+	}
+
+	return upload, nil
+}
+
+// saveFile sniffs the content type of the part and copies it to a new file in dir
+func saveFile(part *multipart.Part, dir string, opts UploadOptions) (*UploadedFile, error) {
+	// sniff the type from the first bytes before writing anything
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if len(opts.AllowedTypes) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if !matchMediaType(mediaType, opts.AllowedTypes) {
+			return nil, errors.Wrapf(ErrUnsupportedFileType, "%s is %s", part.FileName(), mediaType)
+		}
+	}
+
+	// the client's file name is never used as a path, only its extension is kept
+	out, err := os.CreateTemp(dir, "upload-*"+sanitizeExt(part.FileName()))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &UploadedFile{
+		FieldName:   part.FormName(),
+		Filename:    part.FileName(),
+		ContentType: contentType,
+		Path:        out.Name(),
+		temp:        opts.Dir == "",
+	}
+
+	var src io.Reader = io.MultiReader(bytes.NewReader(head), part)
+	if opts.MaxFileSize > 0 {
+		src = newMaxReader(src, nil, opts.MaxFileSize)
+	}
+
+	f.Size, err = io.Copy(out, src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return f, err
+}
+
+// sanitizeExt returns the extension of name if it only contains safe characters
+func sanitizeExt(name string) string {
+	ext := filepath.Ext(filepath.Base(name))
+	if len(ext) > 16 {
+		return ""
+	}
+
+	for _, c := range strings.TrimPrefix(ext, ".") {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+
+	return ext
+}
@@ -0,0 +1,115 @@
+package nova
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func multipartBody(files map[string]string) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("name", "nova")
+	for name, contents := range files {
+		fw, _ := w.CreateFormFile("file", name)
+		fw.Write([]byte(contents))
+	}
+	w.Close()
+
+	return &buf, w.FormDataContentType()
+}
+
+func TestRequest_SaveUploads(t *testing.T) {
+	var saved string
+	s := New()
+	s.Post("/upload", func(r *Request) error {
+		upload, err := r.SaveUploads(UploadOptions{AllowedTypes: []string{"text/"}})
+		if err != nil {
+			return err
+		}
+
+		f := upload.File("file")
+		if f == nil || upload.Values.Get("name") != "nova" {
+			t.Fatal("upload missing fields")
+		}
+
+		if f.Filename != "hello.txt" || f.Size != 11 || !strings.HasPrefix(f.ContentType, "text/plain") {
+			t.Errorf("unexpected file %+v", f)
+		}
+
+		data, _ := ioutil.ReadFile(f.Path)
+		if string(data) != "hello world" {
+			t.Errorf("expected hello world got %s", data)
+		}
+
+		saved = f.Path
+		return nil
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	body, contentType := multipartBody(map[string]string{"hello.txt": "hello world"})
+	res, err := http.Post(ts.URL+"/upload", contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 got %d", res.StatusCode)
+	}
+
+	if _, err := os.Stat(saved); !os.IsNotExist(err) {
+		t.Error("temp file wasn't removed after the handler returned")
+	}
+}
+
+func TestRequest_SaveUploadsLimits(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	s.Post("/upload", func(r *Request) error {
+		_, err := r.SaveUploads(UploadOptions{
+			Dir:          dir,
+			MaxFiles:     1,
+			MaxFileSize:  16,
+			AllowedTypes: []string{"text/"},
+		})
+		return err
+	})
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	tests := []struct {
+		files map[string]string
+		code  int
+	}{
+		{map[string]string{"a.txt": "a", "b.txt": "b"}, http.StatusRequestEntityTooLarge},
+		{map[string]string{"a.txt": strings.Repeat("a", 32)}, http.StatusRequestEntityTooLarge},
+		{map[string]string{"a.png": "\x89PNG\r\n\x1a\n"}, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		body, contentType := multipartBody(test.files)
+		res, err := http.Post(ts.URL+"/upload", contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.code {
+			t.Errorf("expected %d got %d", test.code, res.StatusCode)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected partial uploads to be removed found %d files", len(entries))
+	}
+}